@@ -2,7 +2,13 @@ module browserRedirectBar
 
 go 1.21
 
-require github.com/getlantern/systray v1.2.2
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/getlantern/systray v1.2.2
+	github.com/stretchr/testify v1.11.1
+	golang.org/x/net v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -16,7 +22,6 @@ require (
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
-	golang.org/x/sys v0.1.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
 )
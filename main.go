@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/url"
 	"os"
@@ -8,9 +9,15 @@ import (
 	"strings"
 
 	"browserRedirectBar/src"
+	"browserRedirectBar/src/services"
 )
 
 func main() {
+	// "brb convert yaml" rewrites the config file in another format and exits
+	if len(os.Args) == 3 && os.Args[1] == "convert" {
+		os.Exit(convertConfig(os.Args[2]))
+	}
+
 	cleanup, err := src.InitLogger()
 	if err != nil {
 		log.Fatal("Failed to initialize logger:", err)
@@ -28,7 +35,8 @@ func main() {
 			continue
 		}
 		var urlStr string
-		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") || strings.HasPrefix(arg, "file://") {
+		// Any URL scheme brb is registered for (http, mailto, tel, zoommtg, ...), or an HTML file
+		if parsed, err := url.Parse(arg); err == nil && len(parsed.Scheme) > 1 {
 			urlStr = arg
 		} else if strings.HasSuffix(strings.ToLower(arg), ".html") || strings.HasSuffix(strings.ToLower(arg), ".htm") || strings.HasSuffix(strings.ToLower(arg), ".xhtml") {
 			absPath, err := filepath.Abs(arg)
@@ -39,7 +47,7 @@ func main() {
 		}
 		if urlStr != "" {
 			select {
-			case app.URLChan() <- urlStr:
+			case app.URLChan() <- services.URLRequest{URL: urlStr}:
 			default:
 				// Channel full, drop URL
 			}
@@ -48,3 +56,24 @@ func main() {
 
 	app.Run()
 }
+
+// convertConfig rewrites the config file in the named format and reports the result on the terminal
+func convertConfig(formatName string) int {
+	format, err := services.ParseConfigFormat(formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	configService, err := services.NewConfigService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open config: %v\n", err)
+		return 1
+	}
+	path, err := configService.ConvertConfig(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot convert config: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Config written to %s\n", path)
+	return 0
+}
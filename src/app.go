@@ -3,6 +3,9 @@ package src
 import (
 	"browserRedirectBar/src/services"
 	_ "embed"
+	"errors"
+	"log"
+	"time"
 
 	"github.com/getlantern/systray"
 )
@@ -14,9 +17,15 @@ var iconData []byte
 type App struct {
 	configService  *services.ConfigService
 	patternService *services.PatternService
+	unwrapService  *services.UnwrapService
+	shortener      *services.ShortenerResolver
+	rewriteService *services.RewriteService
+	paramScrubber  *services.ParamScrubber
 	browserService *services.BrowserService
 	menuService    *services.MenuService
-	urlChan        chan string
+	chooser        *services.ChooserService
+	urlChan        chan services.URLRequest
+	stop           chan struct{} // Closed on exit to stop background work
 }
 
 // NewApp creates a new App instance
@@ -27,38 +36,65 @@ func NewApp() (*App, error) {
 	}
 
 	config := configService.GetConfig()
-	patternService := services.NewPatternService(config)
-	browserService := services.NewBrowserService()
+	unwrapService := services.NewUnwrapService(config.Wrappers)
+	shortener := services.NewShortenerResolver(config.Shorteners)
+	rewriteService := services.NewRewriteService(config.Rewrites)
+	app := &App{
+		configService:  configService,
+		patternService: services.NewPatternServiceWithRules(configService.GetRules()),
+		unwrapService:  unwrapService,
+		shortener:      shortener,
+		rewriteService: rewriteService,
+		paramScrubber:  services.NewParamScrubber(config.TrackingParams),
+		browserService: services.NewBrowserService(),
+		urlChan:        make(chan services.URLRequest, 10),
+		stop:           make(chan struct{}),
+	}
+	app.chooser = services.NewChooserService(configService.GetRules().AskTimeout(), app.openDecision)
+	app.patternService.SetURLPipeline(services.NewURLPipeline(unwrapService, shortener, rewriteService))
+	app.patternService.SetParamScrubber(app.paramScrubber)
+	services.SetLogLevel(config.LogLevel)
 	defaultBrowserService := services.NewDefaultBrowserService()
-	urlChan := make(chan string, 10)
 	configPath := configService.GetConfigPath()
 
-	var menuService *services.MenuService
-	menuService = services.NewMenuService(configPath, urlChan, func(url string) {
-		browserPath := patternService.FindBrowserForURL(url)
-		if browserPath == "" {
-			browserPath = configService.GetConfig().DefaultBrowserURL
-		}
-		if browserPath == "" {
-			browserPath = "/Applications/Safari.app"
-		}
-		browserService.OpenBrowser(browserPath, url)
-	}, configService, func() {
-		if err := configService.Load(); err != nil {
-			menuService.ShowConfigError(err.Error())
-		} else {
-			menuService.ClearConfigError()
-			patternService.UpdateConfig(configService.GetConfig())
-		}
-	}, defaultBrowserService)
+	menuService := services.NewMenuService(configPath, app.urlChan, app.HandleURL, configService, app.reloadConfig, defaultBrowserService)
+	menuService.SetChooser(app.chooser)
+	app.chooser.SetLearner(app.learnChoice)
+	app.menuService = menuService
 
-	return &App{
-		configService:  configService,
-		patternService: patternService,
-		browserService: browserService,
-		menuService:    menuService,
-		urlChan:        urlChan,
-	}, nil
+	return app, nil
+}
+
+// reloadConfig loads the config from disk again and applies it, or shows why it is invalid
+func (a *App) reloadConfig() {
+	if err := a.configService.Load(); err != nil {
+		a.menuService.ShowConfigError(err.Error())
+		return
+	}
+	a.menuService.ClearConfigError()
+	a.applyConfig(a.configService.GetConfigAndRules())
+}
+
+// subscriptionsSynced applies rule packs that changed in a background sync and updates the menu
+func (a *App) subscriptionsSynced(changed bool, err error) {
+	if err != nil {
+		log.Printf("Cannot sync rule packs: %v", err)
+	}
+	if changed {
+		a.reloadConfig()
+	}
+	a.menuService.UpdateSubscriptionMenuItems()
+}
+
+// applyConfig hands a freshly loaded configuration and its compiled rules to the services that depend on it
+func (a *App) applyConfig(config services.Config, rules *services.CompiledRules) {
+	a.patternService.UpdateRules(rules)
+	a.unwrapService.UpdateWrappers(config.Wrappers)
+	a.shortener.UpdateConfig(config.Shorteners)
+	a.rewriteService.UpdateRules(config.Rewrites)
+	a.paramScrubber.UpdateConfig(config.TrackingParams)
+	a.chooser.SetTimeout(rules.AskTimeout())
+	services.SetLogLevel(config.LogLevel)
 }
 
 // Run starts the menu bar application
@@ -67,30 +103,76 @@ func (a *App) Run() {
 }
 
 // URLChan returns the channel used to receive URLs (e.g. from command line when launched as default browser)
-func (a *App) URLChan() chan string {
+func (a *App) URLChan() chan services.URLRequest {
 	return a.urlChan
 }
 
-// HandleURL finds the appropriate browser for the URL and opens it (used by tests)
-func (a *App) HandleURL(url string) {
-	config := a.configService.GetConfig()
-	browserPath := a.patternService.FindBrowserForURL(url)
-	if browserPath == "" {
-		browserPath = config.DefaultBrowserURL
+// HandleURL runs the URL through the pipeline, removes tracking parameters, finds the
+// appropriate browser for it and opens the result (used by tests).
+// With debug logging on, the full decision trace is logged.
+func (a *App) HandleURL(request services.URLRequest) {
+	var decision services.Decision
+	if services.DebugEnabled() {
+		decision = a.patternService.Explain(request)
+		services.Debugf("%s", decision)
+	} else {
+		decision = a.patternService.Resolve(request)
+	}
+	if decision.Ask && a.chooser != nil {
+		link := a.chooser.Park(decision)
+		if a.menuService != nil {
+			a.menuService.NotifyPendingLink(link)
+		}
+		return
+	}
+	a.openDecision(decision)
+}
+
+// openDecision opens the URL of a decision in its browser, or in every browser of a fan-out rule
+func (a *App) openDecision(decision services.Decision) {
+	if decision.BrowserURL == "" {
+		log.Printf("No application for %s, add a rule or a defaultApps entry for %q", decision.Request.URL, decision.Scheme)
+		return
+	}
+	if len(decision.BrowserURLs) > 1 {
+		for _, result := range a.browserService.OpenBrowsers(decision.BrowserURLs, decision.OpenURL, decision.Launch) {
+			if result.Err != nil {
+				log.Printf("Failed to open %s in %s: %v", decision.OpenURL, result.BrowserPath, result.Err)
+			} else {
+				log.Printf("Opened %s in %s", decision.OpenURL, result.BrowserPath)
+			}
+		}
+		return
 	}
-	if browserPath == "" {
-		browserPath = "/Applications/Safari.app"
+	a.browserService.OpenBrowserWithOptions(decision.BrowserURL, decision.OpenURL, decision.Launch)
+}
+
+// learnChoice saves a browser choice as a learned rule and applies the updated config
+func (a *App) learnChoice(decision services.Decision) error {
+	rule, err := a.configService.AddLearnedRule(decision.MatchURL, decision.BrowserURL, decision.Launch.Profile)
+	var ruleErrs services.ConfigErrors
+	if errors.As(err, &ruleErrs) {
+		// The rule is saved, but takes effect once the invalid rules are fixed
+		a.menuService.ShowConfigError(err.Error())
+	} else if err != nil {
+		return err
 	}
-	a.browserService.OpenBrowser(browserPath, url)
+	log.Printf("Learned rule: %+v -> %s", rule.Matchers[0], rule.BrowserURL)
+	a.applyConfig(a.configService.GetConfigAndRules())
+	a.menuService.UpdateLearnedMenuItems()
+	return nil
 }
 
 // onReady is called when the systray is ready (run loop is active)
 func (a *App) onReady() {
 	services.SetupAppleEventHandler(a.urlChan)
 	a.menuService.OnReady(iconData)
+	go a.chooser.Run(time.Second, a.stop)
+	go a.configService.RunSubscriptions(time.Minute, a.stop, a.subscriptionsSynced)
 }
 
 // onExit is called when the systray exits
 func (a *App) onExit() {
+	close(a.stop)
 	a.menuService.OnExit()
 }
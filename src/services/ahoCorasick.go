@@ -0,0 +1,122 @@
+package services
+
+// ahoCorasick finds every occurrence of a set of byte strings in a single pass over the text
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+// acEdge is a transition of the automaton on one byte
+type acEdge struct {
+	label byte
+	node  int32
+}
+
+// acNode is a state of the automaton
+type acNode struct {
+	edges []acEdge // Sorted by label; most states have few transitions
+	fail  int32    // Longest proper suffix that is also a state
+	dict  int32    // Nearest state on the fail chain that ends a pattern, or -1
+	ids   []int32  // Patterns ending at this state
+}
+
+// newAhoCorasick builds the automaton; the id of a pattern is its index in the slice
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{dict: -1}}}
+	for id, pattern := range patterns {
+		state := int32(0)
+		for i := 0; i < len(pattern); i++ {
+			next, ok := ac.edge(state, pattern[i])
+			if !ok {
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{dict: -1})
+				ac.addEdge(state, pattern[i], next)
+			}
+			state = next
+		}
+		ac.nodes[state].ids = append(ac.nodes[state].ids, int32(id))
+	}
+
+	// Breadth-first, so the fail state of a node is complete before its children need it
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, e := range ac.nodes[0].edges {
+		queue = append(queue, e.node)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, e := range ac.nodes[state].edges {
+			fail := ac.nodes[state].fail
+			for {
+				if next, ok := ac.edge(fail, e.label); ok {
+					ac.nodes[e.node].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			failNode := ac.nodes[e.node].fail
+			if len(ac.nodes[failNode].ids) > 0 {
+				ac.nodes[e.node].dict = failNode
+			} else {
+				ac.nodes[e.node].dict = ac.nodes[failNode].dict
+			}
+			queue = append(queue, e.node)
+		}
+	}
+	return ac
+}
+
+// edge returns the transition from state on label, if any
+func (ac *ahoCorasick) edge(state int32, label byte) (int32, bool) {
+	edges := ac.nodes[state].edges
+	lo, hi := 0, len(edges)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if edges[mid].label < label {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(edges) && edges[lo].label == label {
+		return edges[lo].node, true
+	}
+	return 0, false
+}
+
+// addEdge inserts a transition, keeping the edges sorted
+func (ac *ahoCorasick) addEdge(state int32, label byte, next int32) {
+	edges := ac.nodes[state].edges
+	i := 0
+	for i < len(edges) && edges[i].label < label {
+		i++
+	}
+	edges = append(edges, acEdge{})
+	copy(edges[i+1:], edges[i:])
+	edges[i] = acEdge{label: label, node: next}
+	ac.nodes[state].edges = edges
+}
+
+// match calls found for every pattern occurrence in text; a pattern occurring twice is reported twice
+func (ac *ahoCorasick) match(text string, found func(id int32)) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.edge(state, text[i]); ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = ac.nodes[state].fail
+		}
+		for out := state; out > 0; out = ac.nodes[out].dict {
+			for _, id := range ac.nodes[out].ids {
+				found(id)
+			}
+		}
+	}
+}
@@ -5,7 +5,7 @@ package services
 #cgo LDFLAGS: -framework Foundation -framework AppKit -framework Carbon
 // Native implementation is in nativeHelpers/; compiled via appleEventNative.m
 extern void setupAppleEventHandler();
-extern void bridgeSendURLToGo(const char* url);
+extern void bridgeSendURLToGo(const char* url, const char* sourceBundleID, int sourcePID);
 */
 import "C"
 
@@ -13,26 +13,32 @@ import (
 	"log"
 )
 
-var urlChannel chan string
+var urlChannel chan URLRequest
 
 //export sendURLToGo
-func sendURLToGo(urlCStr *C.char) {
+func sendURLToGo(urlCStr *C.char, sourceBundleIDCStr *C.char, sourcePID C.int) {
 	if urlCStr == nil {
 		return
 	}
-	url := C.GoString(urlCStr)
+	request := URLRequest{
+		URL:       C.GoString(urlCStr),
+		SourcePID: int(sourcePID),
+	}
+	if sourceBundleIDCStr != nil {
+		request.SourceApp = C.GoString(sourceBundleIDCStr)
+	}
 	if urlChannel == nil {
 		return
 	}
 	select {
-	case urlChannel <- url:
+	case urlChannel <- request:
 	default:
 		log.Printf("Apple Event: URL channel full, dropping URL")
 	}
 }
 
 // SetupAppleEventHandler sets up the Apple Event handler to receive URLs when the app is already running
-func SetupAppleEventHandler(urlChan chan string) {
+func SetupAppleEventHandler(urlChan chan URLRequest) {
 	urlChannel = urlChan
 	C.setupAppleEventHandler()
 }
@@ -1,72 +1,86 @@
 package services
 
 import (
+	"errors"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 )
 
 // BrowserInfo represents information about a detected browser
 type BrowserInfo struct {
-	Name string // Display name (e.g., "Google Chrome")
-	Path string // Full path (e.g., "/Applications/Google Chrome.app")
+	Name     string           // Display name (e.g., "Google Chrome")
+	Path     string           // Full path (e.g., "/Applications/Google Chrome.app")
+	Profiles []BrowserProfile // Profiles found for the browser; empty if it has none or they are unknown
 }
 
 // knownBrowser defines an app bundle name and its display name in the menu
 type knownBrowser struct {
 	AppName     string // e.g. "Google Chrome.app"
 	DisplayName string // e.g. "Google Chrome"
+	ProfileDir  string // Data directory inside ~/Library/Application Support, e.g. "Google/Chrome"; empty if profiles are not supported
 }
 
 // knownBrowsers is the single source for detection order and display-name mapping
 var knownBrowsers = []knownBrowser{
-	{"Safari.app", "Safari"},
-	{"Google Chrome.app", "Google Chrome"},
-	{"Firefox.app", "Firefox"},
-	{"Microsoft Edge.app", "Microsoft Edge"},
-	{"Edge.app", "Edge"},
-	{"Brave Browser.app", "Brave"},
-	{"Arc.app", "Arc"},
-	{"Zen Browser.app", "Zen"},
-	{"Island.app", "Island"},
-	{"Opera.app", "Opera"},
-	{"Vivaldi.app", "Vivaldi"},
-	{"Orion.app", "Orion"},
-	{"Chrome.app", "Chrome"},
-	{"Chromium.app", "Chromium"},
-	{"Firefox Developer Edition.app", "Firefox Developer"},
-	{"Firefox Nightly.app", "Firefox Nightly"},
-	{"Opera Developer.app", "Opera Developer"},
-	{"Opera Beta.app", "Opera Beta"},
-	{"Chrome Beta.app", "Chrome Beta"},
-	{"Chrome Dev.app", "Chrome Dev"},
-	{"Chrome Canary.app", "Chrome Canary"},
-	{"Edge Beta.app", "Edge Beta"},
-	{"Edge Dev.app", "Edge Dev"},
-	{"Edge Canary.app", "Edge Canary"},
+	{"Safari.app", "Safari", ""},
+	{"Google Chrome.app", "Google Chrome", "Google/Chrome"},
+	{"Firefox.app", "Firefox", "Firefox"},
+	{"Microsoft Edge.app", "Microsoft Edge", "Microsoft Edge"},
+	{"Edge.app", "Edge", "Microsoft Edge"},
+	{"Brave Browser.app", "Brave", "BraveSoftware/Brave-Browser"},
+	{"Arc.app", "Arc", ""},
+	{"Zen Browser.app", "Zen", "zen"},
+	{"Island.app", "Island", ""},
+	{"Opera.app", "Opera", ""},
+	{"Vivaldi.app", "Vivaldi", "Vivaldi"},
+	{"Orion.app", "Orion", ""},
+	{"Chrome.app", "Chrome", "Google/Chrome"},
+	{"Chromium.app", "Chromium", "Chromium"},
+	{"Firefox Developer Edition.app", "Firefox Developer", "Firefox"},
+	{"Firefox Nightly.app", "Firefox Nightly", "Firefox"},
+	{"Opera Developer.app", "Opera Developer", ""},
+	{"Opera Beta.app", "Opera Beta", ""},
+	{"Chrome Beta.app", "Chrome Beta", "Google/Chrome Beta"},
+	{"Chrome Dev.app", "Chrome Dev", "Google/Chrome Dev"},
+	{"Chrome Canary.app", "Chrome Canary", "Google/Chrome Canary"},
+	{"Edge Beta.app", "Edge Beta", "Microsoft Edge Beta"},
+	{"Edge Dev.app", "Edge Dev", "Microsoft Edge Dev"},
+	{"Edge Canary.app", "Edge Canary", "Microsoft Edge Canary"},
 }
 
 // BrowserDetector handles browser detection on macOS
-type BrowserDetector struct{}
+type BrowserDetector struct {
+	searchPaths []string // Directories that contain browser applications
+	supportDir  string   // Directory that contains the browsers' data directories
+}
 
 // NewBrowserDetector creates a new BrowserDetector instance
 func NewBrowserDetector() *BrowserDetector {
-	return &BrowserDetector{}
+	home := os.Getenv("HOME")
+	// Common browser locations on macOS
+	return NewBrowserDetectorWithPaths(
+		[]string{"/Applications", filepath.Join(home, "Applications")},
+		filepath.Join(home, "Library", "Application Support"),
+	)
+}
+
+// NewBrowserDetectorWithPaths creates a BrowserDetector that looks for applications and
+// profile data in the given directories (for testing)
+func NewBrowserDetectorWithPaths(searchPaths []string, supportDir string) *BrowserDetector {
+	return &BrowserDetector{searchPaths: searchPaths, supportDir: supportDir}
 }
 
 // DetectBrowsers scans common browser locations and returns a list of found browsers
+// together with their profiles
 func (bd *BrowserDetector) DetectBrowsers() []BrowserInfo {
 	var browsers []BrowserInfo
 
-	// Common browser locations on macOS
-	searchPaths := []string{
-		"/Applications",
-		filepath.Join(os.Getenv("HOME"), "Applications"),
-	}
-
 	// Track found browsers to avoid duplicates
 	foundPaths := make(map[string]bool)
 
-	for _, searchPath := range searchPaths {
+	for _, searchPath := range bd.searchPaths {
 		for _, b := range knownBrowsers {
 			browserPath := filepath.Join(searchPath, b.AppName)
 
@@ -82,8 +96,9 @@ func (bd *BrowserDetector) DetectBrowsers() []BrowserInfo {
 			foundPaths[normalizedPath] = true
 
 			browsers = append(browsers, BrowserInfo{
-				Name: bd.displayName(b.AppName, b.DisplayName),
-				Path: normalizedPath,
+				Name:     bd.displayName(b.AppName, b.DisplayName),
+				Path:     normalizedPath,
+				Profiles: bd.profiles(normalizedPath, b.ProfileDir),
 			})
 		}
 	}
@@ -95,3 +110,18 @@ func (bd *BrowserDetector) DetectBrowsers() []BrowserInfo {
 func (bd *BrowserDetector) displayName(_, displayName string) string {
 	return displayName
 }
+
+// profiles returns the profiles of a browser, or nil if it has none that can be chosen
+func (bd *BrowserDetector) profiles(browserPath, profileDir string) []BrowserProfile {
+	if profileDir == "" || bd.supportDir == "" {
+		return nil
+	}
+	profiles, err := ReadBrowserProfiles(BrowserFamilyOf(browserPath), filepath.Join(bd.supportDir, profileDir))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Cannot read profiles of %s: %v", browserPath, err)
+		}
+		return nil
+	}
+	return profiles
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"log"
 	"os/exec"
+	"strings"
 )
 
 // BrowserOpener defines the interface for opening browsers
@@ -10,6 +11,13 @@ type BrowserOpener interface {
 	OpenBrowser(browserPath string, url string)
 }
 
+// LaunchOptionsOpener is a BrowserOpener that can also apply launch options and report failures
+type LaunchOptionsOpener interface {
+	BrowserOpener
+	// LaunchBrowser opens a URL in exactly the given browser, without falling back to the system
+	LaunchBrowser(browserPath string, url string, opts LaunchOptions) error
+}
+
 // RealBrowserOpener is the production implementation that actually opens browsers
 type RealBrowserOpener struct{}
 
@@ -18,14 +26,30 @@ func NewRealBrowserOpener() *RealBrowserOpener {
 	return &RealBrowserOpener{}
 }
 
-// OpenBrowser opens a URL in the specified browser
+// OpenBrowser opens a URL in the specified browser or application.
+// If that fails, web URLs are handed to the system; other schemes are not, since brb may be
+// their registered handler and would receive them again.
 func (r *RealBrowserOpener) OpenBrowser(browserPath string, url string) {
-	cmd := exec.Command("open", "-a", browserPath, url)
-	err := cmd.Run()
+	err := r.LaunchBrowser(browserPath, url, LaunchOptions{})
 	if err == nil {
 		return
 	}
+	scheme, _, _ := strings.Cut(url, ":")
+	if !webSchemes[strings.ToLower(scheme)] {
+		log.Printf("Failed to open %s in %s: %v", url, browserPath, err)
+		return
+	}
 	if fallbackErr := exec.Command("open", url).Run(); fallbackErr != nil {
 		log.Printf("Failed to open browser %s: %v; fallback failed: %v", browserPath, err, fallbackErr)
 	}
 }
+
+// LaunchBrowser opens a URL in the specified browser with launch options.
+// Options the browser does not support are logged and skipped.
+func (r *RealBrowserOpener) LaunchBrowser(browserPath string, url string, opts LaunchOptions) error {
+	args, ignored := BuildLaunchArgs(browserPath, url, opts)
+	if len(ignored) > 0 {
+		log.Printf("%s does not support %s; opening the URL without", browserPath, strings.Join(ignored, ", "))
+	}
+	return exec.Command("open", args...).Run()
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BrowserProfile is a profile of an installed browser
+type BrowserProfile struct {
+	ID        string // Value for a rule's "profile": the directory for Chromium browsers, the profile name for Firefox
+	Name      string // Display name (e.g., "Work")
+	Directory string // Profile directory inside the browser's data directory (e.g., "Profile 1")
+	Default   bool   // The profile the browser opens when none is given
+}
+
+// chromiumLocalState is the part of Chromium's "Local State" file that lists profiles
+type chromiumLocalState struct {
+	Profile struct {
+		InfoCache map[string]struct {
+			Name string `json:"name"`
+		} `json:"info_cache"`
+		ProfilesOrder []string `json:"profiles_order"`
+		LastUsed      string   `json:"last_used"`
+	} `json:"profile"`
+}
+
+// ReadBrowserProfiles returns the profiles stored in a browser's data directory
+func ReadBrowserProfiles(family BrowserFamily, dataDir string) ([]BrowserProfile, error) {
+	switch family {
+	case BrowserFamilyChromium:
+		return ReadChromiumProfiles(dataDir)
+	case BrowserFamilyFirefox:
+		return ReadFirefoxProfiles(dataDir)
+	default:
+		return nil, nil
+	}
+}
+
+// ReadChromiumProfiles reads the profiles from the "Local State" file in a Chromium data directory,
+// in the order the browser shows them
+func ReadChromiumProfiles(dataDir string) ([]BrowserProfile, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, "Local State"))
+	if err != nil {
+		return nil, err
+	}
+	var state chromiumLocalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse Local State: %w", err)
+	}
+
+	order := make([]string, 0, len(state.Profile.InfoCache))
+	seen := make(map[string]bool)
+	for _, dir := range state.Profile.ProfilesOrder {
+		if _, ok := state.Profile.InfoCache[dir]; ok && !seen[dir] {
+			order = append(order, dir)
+			seen[dir] = true
+		}
+	}
+	var rest []string
+	for dir := range state.Profile.InfoCache {
+		if !seen[dir] {
+			rest = append(rest, dir)
+		}
+	}
+	sort.Strings(rest)
+	order = append(order, rest...)
+
+	// Without arguments Chromium opens the profile used last
+	lastUsed := state.Profile.LastUsed
+	if lastUsed == "" {
+		lastUsed = "Default"
+	}
+	profiles := make([]BrowserProfile, 0, len(order))
+	for _, dir := range order {
+		name := state.Profile.InfoCache[dir].Name
+		if name == "" {
+			name = dir
+		}
+		profiles = append(profiles, BrowserProfile{ID: dir, Name: name, Directory: dir, Default: dir == lastUsed})
+	}
+	return profiles, nil
+}
+
+// ReadFirefoxProfiles reads the profiles from profiles.ini in a Firefox data directory,
+// in the order they are listed
+func ReadFirefoxProfiles(dataDir string) ([]BrowserProfile, error) {
+	file, err := os.Open(filepath.Join(dataDir, "profiles.ini"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var profiles []BrowserProfile
+	installDefaults := make(map[string]bool) // Profile paths marked as default by an [Install...] section
+	current := -1                            // Index of the profile whose section is being read
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			current = -1
+			if strings.HasPrefix(section, "Profile") {
+				profiles = append(profiles, BrowserProfile{})
+				current = len(profiles) - 1
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case current >= 0 && key == "Name":
+			profiles[current].Name, profiles[current].ID = value, value
+		case current >= 0 && key == "Path":
+			profiles[current].Directory = value
+		case current >= 0 && key == "Default":
+			profiles[current].Default = value == "1"
+		case strings.HasPrefix(section, "Install") && key == "Default":
+			installDefaults[value] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newer versions record the default per installation; it wins over the legacy Default=1
+	result := profiles[:0]
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			continue
+		}
+		if len(installDefaults) > 0 {
+			profile.Default = installDefaults[profile.Directory]
+		}
+		result = append(result, profile)
+	}
+	return result, nil
+}
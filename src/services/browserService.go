@@ -1,6 +1,22 @@
 package services
 
-import "log"
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+// Open modes for rules that name several browsers
+const (
+	OpenFirst = "first" // Open the URL in the first browser listed (default)
+	OpenAll   = "all"   // Open the URL in every browser listed at the same time
+)
+
+// OpenResult is the outcome of opening a URL in one browser
+type OpenResult struct {
+	BrowserPath string
+	Err         error // nil if the browser was started
+}
 
 // BrowserService handles browser operations
 type BrowserService struct {
@@ -29,3 +45,62 @@ func (bs *BrowserService) OpenBrowser(browserPath string, url string) {
 	}
 	bs.opener.OpenBrowser(browserPath, url)
 }
+
+// OpenBrowserWithOptions opens a URL in the specified browser with launch options.
+// If the browser cannot be started with the options, or the opener does not support
+// them, the URL is opened without them.
+func (bs *BrowserService) OpenBrowserWithOptions(browserPath string, url string, opts LaunchOptions) {
+	if bs.opener == nil {
+		log.Printf("BrowserOpener is nil")
+		return
+	}
+	if opener, ok := bs.opener.(LaunchOptionsOpener); ok && opts != (LaunchOptions{}) {
+		err := opener.LaunchBrowser(browserPath, url, opts)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to open %s with %s: %v; opening it without", browserPath, opts, err)
+	}
+	bs.opener.OpenBrowser(browserPath, url)
+}
+
+// OpenBrowsers opens a URL in every given browser at the same time and reports the result
+// for each, in the order of browserPaths. Browsers that fail are not replaced by the system
+// default, so a failure shows up in the results instead of opening the URL twice.
+func (bs *BrowserService) OpenBrowsers(browserPaths []string, url string, opts LaunchOptions) []OpenResult {
+	results := make([]OpenResult, len(browserPaths))
+	if bs.opener == nil {
+		log.Printf("BrowserOpener is nil")
+		for i, browserPath := range browserPaths {
+			results[i] = OpenResult{BrowserPath: browserPath, Err: errors.New("no browser opener")}
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for i, browserPath := range browserPaths {
+		wg.Add(1)
+		go func(i int, browserPath string) {
+			defer wg.Done()
+			results[i] = OpenResult{BrowserPath: browserPath, Err: bs.launch(browserPath, url, opts)}
+		}(i, browserPath)
+	}
+	wg.Wait()
+	return results
+}
+
+// launch opens a URL in exactly one browser, retrying without options if they fail.
+// Openers that cannot report failures are assumed to succeed.
+func (bs *BrowserService) launch(browserPath string, url string, opts LaunchOptions) error {
+	opener, ok := bs.opener.(LaunchOptionsOpener)
+	if !ok {
+		bs.opener.OpenBrowser(browserPath, url)
+		return nil
+	}
+	err := opener.LaunchBrowser(browserPath, url, opts)
+	if err != nil && opts != (LaunchOptions{}) {
+		log.Printf("Failed to open %s with %s: %v; opening it without", browserPath, opts, err)
+		err = opener.LaunchBrowser(browserPath, url, LaunchOptions{})
+	}
+	return err
+}
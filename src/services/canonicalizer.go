@@ -0,0 +1,198 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// canonicalURL is a URL in the forms rules are matched against
+type canonicalURL struct {
+	raw           string   // Canonical form with an ASCII (punycode) host
+	lower         string   // raw in lower case, for substring patterns
+	parsed        *url.URL // nil if the URL cannot be parsed
+	unicode       string   // The same URL with a Unicode host, or "" for hosts without IDN labels
+	unicodeLower  string
+	original      string // The URL as given, only trimmed; regexes written for it keep matching
+	originalLower string
+}
+
+// CanonicalizeURL returns the form of a URL that rules are matched against: lower-case
+// scheme and host, IDN hosts in ASCII (punycode), no trailing dot or default port, uniform
+// percent-encoding and no embedded whitespace. The URL that is opened is not changed.
+func CanonicalizeURL(rawURL string) string {
+	return canonicalize(rawURL).raw
+}
+
+// canonicalize builds the canonical forms of a URL and keeps the URL as given for regexes
+func canonicalize(rawURL string) canonicalURL {
+	target := canonicalForms(rawURL)
+	target.original = strings.TrimSpace(rawURL)
+	target.originalLower = strings.ToLower(target.original)
+	return target
+}
+
+// canonicalForms builds the canonical forms of a URL
+func canonicalForms(rawURL string) canonicalURL {
+	cleaned := stripWhitespace(rawURL)
+	parsed, err := url.Parse(cleaned)
+	if err != nil {
+		return newCanonicalURL(cleaned, nil, "")
+	}
+	if parsed.Host == "" {
+		// Opaque URLs such as mailto: only get a lower-case scheme
+		parsed.Scheme = strings.ToLower(parsed.Scheme)
+		return newCanonicalURL(parsed.String(), parsed, "")
+	}
+
+	host := canonicalHost(parsed.Hostname())
+	port := parsed.Port()
+	if defaultPort, ok := defaultPorts[parsed.Scheme]; ok && port != "" {
+		if number, err := strconv.Atoi(port); err == nil && number == defaultPort {
+			port = ""
+		}
+	}
+	path := normalizePercentEncoding(parsed.EscapedPath())
+	if path == "" && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		path = "/"
+	}
+
+	build := func(host string) string {
+		var b strings.Builder
+		b.WriteString(parsed.Scheme)
+		b.WriteString("://")
+		if parsed.User != nil {
+			b.WriteString(parsed.User.String())
+			b.WriteString("@")
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+		b.WriteString(host)
+		if port != "" {
+			b.WriteString(":" + port)
+		}
+		b.WriteString(path)
+		if parsed.ForceQuery || parsed.RawQuery != "" {
+			b.WriteString("?" + normalizePercentEncoding(parsed.RawQuery))
+		}
+		if parsed.Fragment != "" {
+			b.WriteString("#" + normalizePercentEncoding(parsed.EscapedFragment()))
+		}
+		return b.String()
+	}
+
+	canonical := build(host)
+	canonicalParsed, err := url.Parse(canonical)
+	if err != nil {
+		canonicalParsed = parsed
+	}
+	unicodeURL := ""
+	if unicodeHost, err := idna.Lookup.ToUnicode(host); err == nil && unicodeHost != host {
+		unicodeURL = build(unicodeHost)
+	}
+	return newCanonicalURL(canonical, canonicalParsed, unicodeURL)
+}
+
+// newCanonicalURL fills in the lower-case forms
+func newCanonicalURL(raw string, parsed *url.URL, unicodeURL string) canonicalURL {
+	return canonicalURL{
+		raw:          raw,
+		lower:        strings.ToLower(raw),
+		parsed:       parsed,
+		unicode:      unicodeURL,
+		unicodeLower: strings.ToLower(unicodeURL),
+	}
+}
+
+// contains reports whether a lower-case pattern occurs in either form of the URL
+func (c canonicalURL) contains(lowerPattern string) bool {
+	return strings.Contains(c.lower, lowerPattern) || c.unicode != "" && strings.Contains(c.unicodeLower, lowerPattern)
+}
+
+// matchRegex reports whether a regex matches the URL as given or either canonical form.
+// Regexes written before URLs were canonicalized may expect a port, an empty path or the case
+// of the host as they appear in the link.
+func (c canonicalURL) matchRegex(re *regexp.Regexp) bool {
+	return c.original != "" && re.MatchString(c.original) || re.MatchString(c.raw) || c.unicode != "" && re.MatchString(c.unicode)
+}
+
+// canonicalHost lowercases a host, drops trailing dots and converts IDN labels to punycode.
+// Hosts that are not valid IDNA (e.g. with underscores) are only lowercased.
+func canonicalHost(host string) string {
+	host = strings.TrimRight(strings.ToLower(strings.TrimSpace(host)), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// canonicalHostPattern is canonicalHost for patterns that may start with a "*." wildcard
+func canonicalHostPattern(host string) string {
+	if suffix, ok := strings.CutPrefix(strings.TrimSpace(host), "*."); ok {
+		return "*." + canonicalHost(suffix)
+	}
+	return canonicalHost(host)
+}
+
+// stripWhitespace removes surrounding whitespace and embedded tabs and line breaks,
+// and encodes the spaces that remain inside the URL
+func stripWhitespace(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	rawURL = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(rawURL)
+	return strings.ReplaceAll(rawURL, " ", "%20")
+}
+
+// normalizePercentEncoding decodes escaped unreserved characters, upper-cases the hex digits
+// of the remaining escapes and escapes bytes that are not printable ASCII
+func normalizePercentEncoding(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[decoded>>4])
+				b.WriteByte(hex[decoded&15])
+			}
+			i += 2
+		case c <= ' ' || c >= 0x7f:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c may appear unescaped anywhere in a URL (RFC 3986, section 2.3)
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// unhex returns the value of a hexadecimal digit
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultAskTimeout is how long a parked link waits for a choice before it opens in the default browser
+const defaultAskTimeout = 60 * time.Second
+
+// PendingLink is a URL waiting for the user to choose a browser
+type PendingLink struct {
+	ID       int
+	Decision Decision // The decision for the URL; its BrowserURL is used when the link times out
+	Deadline time.Time
+	Remember bool // Remember the chosen browser for the link's domain
+}
+
+// ChooserLearnFunc remembers the browser chosen for a link, as described by the decision
+type ChooserLearnFunc func(decision Decision) error
+
+// ChooserOpenFunc opens a link that has been chosen or has timed out, as described by the decision
+type ChooserOpenFunc func(decision Decision)
+
+// ChooserService parks links until a browser is chosen for them. A link that is not
+// chosen before its deadline opens in the browser of its decision; a cancelled link is dropped.
+// It keeps no UI state, so MenuService renders Pending and calls Choose or Cancel.
+type ChooserService struct {
+	mu       sync.Mutex
+	pending  []PendingLink // In the order the links arrived
+	nextID   int
+	timeout  time.Duration
+	clock    Clock
+	open     ChooserOpenFunc
+	learn    ChooserLearnFunc
+	onChange func()
+}
+
+// NewChooserService creates a new ChooserService that opens links with the given function
+func NewChooserService(timeout time.Duration, open ChooserOpenFunc) *ChooserService {
+	cs := &ChooserService{clock: realClock{}, open: open, nextID: 1}
+	cs.SetTimeout(timeout)
+	return cs
+}
+
+// SetClock replaces the clock used for deadlines (for testing)
+func (cs *ChooserService) SetClock(clock Clock) {
+	cs.mu.Lock()
+	cs.clock = clock
+	cs.mu.Unlock()
+}
+
+// SetTimeout changes how long new links wait for a choice; zero or less uses the default
+func (cs *ChooserService) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultAskTimeout
+	}
+	cs.mu.Lock()
+	cs.timeout = timeout
+	cs.mu.Unlock()
+}
+
+// SetOnChange registers a callback that runs whenever the pending links change
+func (cs *ChooserService) SetOnChange(onChange func()) {
+	cs.mu.Lock()
+	cs.onChange = onChange
+	cs.mu.Unlock()
+}
+
+// SetLearner registers the function that remembers choices of links marked with SetRemember
+func (cs *ChooserService) SetLearner(learn ChooserLearnFunc) {
+	cs.mu.Lock()
+	cs.learn = learn
+	cs.mu.Unlock()
+}
+
+// SetRemember marks whether the choice for a pending link should be remembered
+func (cs *ChooserService) SetRemember(id int, remember bool) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for i := range cs.pending {
+		if cs.pending[i].ID == id {
+			cs.pending[i].Remember = remember
+			return nil
+		}
+	}
+	return fmt.Errorf("no pending link with id %d", id)
+}
+
+// Park queues a link until a browser is chosen for it
+func (cs *ChooserService) Park(decision Decision) PendingLink {
+	cs.mu.Lock()
+	link := PendingLink{ID: cs.nextID, Decision: decision, Deadline: cs.clock.Now().Add(cs.timeout)}
+	cs.nextID++
+	cs.pending = append(cs.pending, link)
+	onChange := cs.onChange
+	cs.mu.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+	return link
+}
+
+// Pending returns the links waiting for a choice, oldest first
+func (cs *ChooserService) Pending() []PendingLink {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return append([]PendingLink(nil), cs.pending...)
+}
+
+// Choose opens a pending link in the given browser and profile. The launch options of the
+// decision are kept; its profile only applies when the decision's own browser is chosen.
+// If the link is marked to be remembered, the choice is learned as well; the link opens
+// even if that fails, and the error is returned.
+func (cs *ChooserService) Choose(id int, browserPath string, profile string) error {
+	link, ok := cs.remove(id)
+	if !ok {
+		return fmt.Errorf("no pending link with id %d", id)
+	}
+	decision := link.Decision
+	if profile != "" || browserPath != decision.BrowserURL {
+		decision.Launch.Profile = profile
+	}
+	decision.BrowserURL, decision.BrowserURLs = browserPath, nil
+	decision.Ask = false
+	cs.open(decision)
+
+	cs.mu.Lock()
+	learn := cs.learn
+	cs.mu.Unlock()
+	if link.Remember && learn != nil {
+		if err := learn(decision); err != nil {
+			return fmt.Errorf("cannot remember the choice: %w", err)
+		}
+	}
+	return nil
+}
+
+// Cancel drops a pending link without opening it
+func (cs *ChooserService) Cancel(id int) error {
+	if _, ok := cs.remove(id); !ok {
+		return fmt.Errorf("no pending link with id %d", id)
+	}
+	return nil
+}
+
+// Expire opens every link whose deadline has passed in the browser of its decision
+// and returns how many were opened
+func (cs *ChooserService) Expire() int {
+	cs.mu.Lock()
+	now := cs.clock.Now()
+	var expired []PendingLink
+	remaining := cs.pending[:0]
+	for _, link := range cs.pending {
+		if now.Before(link.Deadline) {
+			remaining = append(remaining, link)
+		} else {
+			expired = append(expired, link)
+		}
+	}
+	cs.pending = remaining
+	onChange := cs.onChange
+	cs.mu.Unlock()
+
+	for _, link := range expired {
+		decision := link.Decision
+		decision.Ask = false
+		cs.open(decision)
+	}
+	if len(expired) > 0 && onChange != nil {
+		onChange()
+	}
+	return len(expired)
+}
+
+// Run calls Expire every interval until stop is closed
+func (cs *ChooserService) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cs.Expire()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// remove takes a link out of the queue
+func (cs *ChooserService) remove(id int) (PendingLink, bool) {
+	cs.mu.Lock()
+	var found PendingLink
+	ok := false
+	for i, link := range cs.pending {
+		if link.ID == id {
+			found, ok = link, true
+			cs.pending = append(cs.pending[:i], cs.pending[i+1:]...)
+			break
+		}
+	}
+	onChange := cs.onChange
+	cs.mu.Unlock()
+
+	if ok && onChange != nil {
+		onChange()
+	}
+	return found, ok
+}
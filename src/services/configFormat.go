@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat is a file format the config can be written in
+type ConfigFormat string
+
+// Supported config formats
+const (
+	FormatJSON ConfigFormat = "json"
+	FormatYAML ConfigFormat = "yaml"
+	FormatTOML ConfigFormat = "toml"
+)
+
+// configFileNames are the config files looked for in the config directory, in order of preference
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// ParseConfigFormat parses a format name: "json", "yaml" (or "yml") or "toml"
+func ParseConfigFormat(name string) (ConfigFormat, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("unknown config format %q, expected json, yaml or toml", name)
+}
+
+// ConfigFormatOf returns the format of a config file from its extension; other extensions are JSON
+func ConfigFormatOf(path string) ConfigFormat {
+	if format, err := ParseConfigFormat(filepath.Ext(path)); err == nil {
+		return format
+	}
+	return FormatJSON
+}
+
+// String returns the name of the format for messages, e.g. "YAML"
+func (f ConfigFormat) String() string {
+	return strings.ToUpper(string(f))
+}
+
+// Extension returns the file extension used for new files in the format, e.g. ".yaml"
+func (f ConfigFormat) Extension() string {
+	return "." + string(f)
+}
+
+// ConvertConfig rewrites the config file in another format next to it, e.g. config.json as
+// config.yaml, and uses the new file from then on. The old file is renamed with a .bak suffix
+// so it is not picked up again. Included files keep their format. It returns the new path.
+func (cs *ConfigService) ConvertConfig(format ConfigFormat) (string, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	current := ConfigFormatOf(cs.configPath)
+	if format == current {
+		return cs.configPath, nil
+	}
+	data, err := os.ReadFile(cs.configPath)
+	if err != nil {
+		return "", err
+	}
+	if data, err = configToJSON(current, data); err != nil {
+		return "", fmt.Errorf("invalid %s in config file: %w", current, err)
+	}
+	config := Config{Browsers: []BrowserConfig{}}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("invalid %s in config file: %w", current, err)
+		}
+	}
+
+	converted, err := encodeConfig(config, format)
+	if err != nil {
+		return "", err
+	}
+	newPath := strings.TrimSuffix(cs.configPath, filepath.Ext(cs.configPath)) + format.Extension()
+	if _, err := os.Stat(newPath); err == nil {
+		return "", fmt.Errorf("%s already exists", newPath)
+	}
+	if err := os.WriteFile(newPath, converted, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(cs.configPath, cs.configPath+".bak"); err != nil {
+		return "", err
+	}
+	cs.configPath = newPath
+	_ = cs.load() // Rule errors are shown by the menu, as on startup
+	return newPath, nil
+}
+
+// findConfigFile returns the config file in a directory, see configFileChoice
+func findConfigFile(dir string) string {
+	path, ignored := configFileChoice(dir)
+	if len(ignored) > 0 {
+		log.Printf("Several config files in %s, using %s and ignoring %s", dir, filepath.Base(path), strings.Join(ignored, ", "))
+	}
+	return path
+}
+
+// configFileChoice returns the config file to use in a directory and the names of the other
+// config files there, which are ignored. The first of configFileNames that exists is used, but an
+// empty config.json, such as the one written on first launch, gives way to the other formats.
+// Without any config file, it returns config.json.
+func configFileChoice(dir string) (string, []string) {
+	var found []string
+	for _, name := range configFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	if len(found) > 1 && found[0] == configFileNames[0] && isEmptyConfigFile(filepath.Join(dir, found[0])) {
+		found = found[1:]
+	}
+	if len(found) == 0 {
+		return filepath.Join(dir, configFileNames[0]), nil
+	}
+	return filepath.Join(dir, found[0]), found[1:]
+}
+
+// ConfigFileConflict describes the config files next to the one in use that are ignored,
+// or returns "" if there are none
+func (cs *ConfigService) ConfigFileConflict() string {
+	path := cs.GetConfigPath()
+	if !slices.Contains(configFileNames, filepath.Base(path)) {
+		return ""
+	}
+	dir := filepath.Dir(path)
+	var ignored []string
+	for _, name := range configFileNames {
+		other := filepath.Join(dir, name)
+		if name == filepath.Base(path) || name == configFileNames[0] && isEmptyConfigFile(other) {
+			continue
+		}
+		if _, err := os.Stat(other); err == nil {
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Several config files in %s: using %s and ignoring %s", dir, filepath.Base(path), strings.Join(ignored, ", "))
+}
+
+// isEmptyConfigFile reports whether a JSON config file is blank or sets nothing, like the file
+// written on first launch
+func isEmptyConfigFile(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	data = stripJSONC(data)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return true
+	}
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return false
+	}
+	for _, value := range document {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			if value != "" {
+				return false
+			}
+		case []any:
+			if len(value) > 0 {
+				return false
+			}
+		case map[string]any:
+			if len(value) > 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// configToJSON converts the contents of a config file in the given format to JSON.
+// JSON files may contain comments and trailing commas (JSONC). Blank files stay empty.
+func configToJSON(format ConfigFormat, data []byte) ([]byte, error) {
+	if format == FormatJSON {
+		return stripJSONC(data), nil
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, nil
+	}
+	document := make(map[string]any)
+	var err error
+	if format == FormatYAML {
+		err = yaml.Unmarshal(data, &document)
+	} else {
+		err = toml.Unmarshal(data, &document)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// encodeConfig writes a config in the given format. Fields are written in the order of the
+// Config struct where the format allows it, and unset optional fields are left out.
+func encodeConfig(config Config, format ConfigFormat) ([]byte, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil || format == FormatJSON {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		// JSON is valid YAML, so decoding it as a node keeps the field order
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		toBlockStyle(&document)
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&document); err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+	case FormatTOML:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var document map[string]any
+		if err := decoder.Decode(&document); err != nil {
+			return nil, err
+		}
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		err = encoder.Encode(tomlValue(document))
+	}
+	return buf.Bytes(), err
+}
+
+// toBlockStyle drops null fields and the JSON flow style and quoting, so the YAML encoder
+// writes block style and only quotes strings where YAML needs it
+func toBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.MappingNode {
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Tag != "!!null" {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+	}
+	for _, child := range node.Content {
+		toBlockStyle(child)
+	}
+}
+
+// tomlValue prepares a decoded JSON value for the TOML encoder: TOML has no null, so null
+// fields are dropped, and numbers become integers where possible
+func tomlValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		table := make(map[string]any, len(value))
+		for key, field := range value {
+			if field != nil {
+				table[key] = tomlValue(field)
+			}
+		}
+		return table
+	case []any:
+		list := make([]any, 0, len(value))
+		for _, item := range value {
+			if item != nil {
+				list = append(list, tomlValue(item))
+			}
+		}
+		return list
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	}
+	return value
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configSpan records which file a range of a merged list came from
+type configSpan struct {
+	file  string // Display name of the file; empty for the main config
+	start int
+	count int
+}
+
+// configSources records where the entries of a merged configuration came from
+type configSources struct {
+	lists   map[string][]configSpan // By top-level key, e.g. "browsers"
+	scalars map[string]string       // File that set each other top-level key
+}
+
+// attribute points errors at the file and index an entry came from
+func (s configSources) attribute(errs ConfigErrors) {
+	for _, ruleErr := range errs {
+		if ruleErr.File != "" {
+			continue
+		}
+		if ruleErr.Index < 0 {
+			ruleErr.File = s.scalars[ruleErr.Section]
+			continue
+		}
+		for _, span := range s.lists[ruleErr.Section] {
+			if ruleErr.Index >= span.start && ruleErr.Index < span.start+span.count {
+				ruleErr.File = span.file
+				ruleErr.Index -= span.start
+				break
+			}
+		}
+	}
+}
+
+// configLoader merges a config file with the files it includes
+type configLoader struct {
+	mainDir string         // Directory of the main config, for display names
+	merged  map[string]any // Merged JSON document
+	sources configSources
+	loaded  map[string]bool // Files already merged, so a file included twice is used once
+	errs    ConfigErrors
+}
+
+// loadConfigWithIncludes parses the main config file, as JSON, and merges the files it includes.
+// Included files may be written in any ConfigFormat.
+// The main file comes first, then each included file in order, with the files an included
+// file includes right after it. Lists are concatenated in that order, nested objects are
+// merged key by key, and any other value comes from the first file that sets it to something
+// other than null or "". It returns the merged config, the main file's own config, where the
+// merged entries came from, and one error per include that could not be used. An invalid main
+// file is returned as err.
+func loadConfigWithIncludes(path string, data []byte) (merged Config, own Config, sources configSources, includeErrs ConfigErrors, err error) {
+	own = Config{Browsers: []BrowserConfig{}}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return own, own, sources, nil, nil
+	}
+	if err := json.Unmarshal(data, &own); err != nil {
+		return Config{}, Config{}, sources, nil, err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	loader := &configLoader{
+		mainDir: filepath.Dir(absPath),
+		merged:  make(map[string]any),
+		sources: configSources{lists: make(map[string][]configSpan), scalars: make(map[string]string)},
+		loaded:  make(map[string]bool),
+	}
+	if err := loader.add(absPath, "", data, nil); err != nil {
+		return Config{}, Config{}, sources, nil, err
+	}
+	loader.addSubscriptions(subscriptionCacheDir(absPath))
+
+	mergedData, err := json.Marshal(loader.merged)
+	if err == nil {
+		err = json.Unmarshal(mergedData, &merged)
+	}
+	if err != nil {
+		return Config{}, Config{}, sources, nil, fmt.Errorf("cannot merge included files: %w", err)
+	}
+	if merged.Browsers == nil {
+		merged.Browsers = []BrowserConfig{}
+	}
+	merged.Include = own.Include
+	return merged, own, loader.sources, loader.errs, nil
+}
+
+// add merges one file and then the files it includes. stack holds the files that include it.
+func (l *configLoader) add(path, display string, data []byte, stack []string) error {
+	doc, err := decodeConfigDocument(data)
+	if err != nil {
+		return err
+	}
+	l.loaded[path] = true
+	l.merge(doc, display)
+
+	includes, _ := doc["include"].([]any)
+	stack = append(stack, path)
+	for i, value := range includes {
+		includePath, _ := value.(string)
+		report := func(err error) {
+			l.errs = append(l.errs, &RuleError{File: display, Section: "include", Index: i, Pattern: includePath, Err: err})
+		}
+		if includePath == "" {
+			report(errors.New("the path must be a non-empty string"))
+			continue
+		}
+		resolved := resolveIncludePath(includePath, filepath.Dir(path))
+		if cycle := includeCycle(stack, resolved, l.displayName); cycle != "" {
+			report(fmt.Errorf("include cycle: %s", cycle))
+			continue
+		}
+		if l.loaded[resolved] {
+			continue
+		}
+		includeData, err := os.ReadFile(resolved)
+		if err != nil {
+			report(err)
+			continue
+		}
+		format := ConfigFormatOf(resolved)
+		if includeData, err = configToJSON(format, includeData); err == nil {
+			err = l.add(resolved, l.displayName(resolved), includeData, stack)
+		}
+		if err != nil {
+			report(fmt.Errorf("invalid %s in %s: %w", format, l.displayName(resolved), err))
+		}
+	}
+	return nil
+}
+
+// addSubscriptions merges the cached copies of the subscribed rule packs, after every local file.
+// Packs that were not downloaded yet are skipped. Packs cannot include files or subscribe to other packs.
+func (l *configLoader) addSubscriptions(cacheDir string) {
+	var subscriptions []Subscription
+	if data, err := json.Marshal(l.merged["subscriptions"]); err == nil {
+		_ = json.Unmarshal(data, &subscriptions)
+	}
+	seen := make(map[string]bool)
+	for i, subscription := range subscriptions {
+		if seen[subscription.URL] {
+			continue
+		}
+		seen[subscription.URL] = true
+		data, err := os.ReadFile(subscriptionFile(cacheDir, subscription.URL))
+		if err != nil {
+			continue
+		}
+		display := "subscription " + subscription.URL
+		doc, err := decodeConfigDocument(stripJSONC(data))
+		if err != nil {
+			ruleErr := &RuleError{Section: "subscriptions", Index: i, Pattern: subscription.URL, Err: fmt.Errorf("invalid cached rule pack: %w", err)}
+			l.sources.attribute(ConfigErrors{ruleErr})
+			l.errs = append(l.errs, ruleErr)
+			continue
+		}
+		for _, key := range []string{"include", "subscriptions"} {
+			if _, ok := doc[key]; ok {
+				l.errs = append(l.errs, &RuleError{File: display, Section: key, Index: -1, Err: errors.New("not allowed in a subscribed rule pack")})
+				delete(doc, key)
+			}
+		}
+		l.merge(doc, display)
+	}
+}
+
+// merge adds a parsed file to the merged document and records where its entries came from
+func (l *configLoader) merge(doc map[string]any, display string) {
+	for key, value := range doc {
+		if key == "include" {
+			continue
+		}
+		existing, ok := l.merged[key]
+		switch {
+		case !ok || isUnset(existing):
+			l.merged[key] = value
+			if list, isList := value.([]any); isList {
+				l.sources.lists[key] = []configSpan{{file: display, count: len(list)}}
+			} else {
+				l.sources.scalars[key] = display
+			}
+		case isList(existing) && isList(value):
+			existingList, list := existing.([]any), value.([]any)
+			l.sources.lists[key] = append(l.sources.lists[key], configSpan{file: display, start: len(existingList), count: len(list)})
+			l.merged[key] = append(existingList, list...)
+		case isObject(existing) && isObject(value):
+			mergeObjects(existing.(map[string]any), value.(map[string]any))
+		}
+	}
+}
+
+// mergeObjects merges src into dst: lists are concatenated, nested objects are merged and
+// other values are only taken from src if dst does not set them
+func mergeObjects(dst, src map[string]any) {
+	for key, value := range src {
+		existing, ok := dst[key]
+		switch {
+		case !ok || isUnset(existing):
+			dst[key] = value
+		case isList(existing) && isList(value):
+			dst[key] = append(existing.([]any), value.([]any)...)
+		case isObject(existing) && isObject(value):
+			mergeObjects(existing.(map[string]any), value.(map[string]any))
+		}
+	}
+}
+
+// decodeConfigDocument parses a config file as a generic JSON document and checks
+// that it is a valid config on its own
+func decodeConfigDocument(data []byte) (map[string]any, error) {
+	doc := make(map[string]any)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep numbers exactly as written
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// resolveIncludePath resolves an include relative to the directory of the file that
+// includes it; "~/" refers to the home directory
+func resolveIncludePath(includePath, dir string) string {
+	if rest, ok := strings.CutPrefix(includePath, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			includePath = filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(dir, includePath)
+	}
+	return filepath.Clean(includePath)
+}
+
+// includeCycle describes the cycle that including path would close, or returns ""
+func includeCycle(stack []string, path string, displayName func(string) string) string {
+	for i, file := range stack {
+		if file == path {
+			names := make([]string, 0, len(stack)-i+1)
+			for _, cyclePath := range stack[i:] {
+				names = append(names, displayName(cyclePath))
+			}
+			return strings.Join(append(names, displayName(path)), " -> ")
+		}
+	}
+	return ""
+}
+
+// displayName shows a file relative to the main config's directory when it is inside it
+func (l *configLoader) displayName(path string) string {
+	if rel, err := filepath.Rel(l.mainDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// isUnset reports whether a JSON value counts as not set when merging
+func isUnset(value any) bool {
+	return value == nil || value == ""
+}
+
+// isList reports whether a JSON value is an array
+func isList(value any) bool {
+	_, ok := value.([]any)
+	return ok
+}
+
+// isObject reports whether a JSON value is an object
+func isObject(value any) bool {
+	_, ok := value.(map[string]any)
+	return ok
+}
@@ -1,29 +1,45 @@
 package services
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 // ConfigService handles configuration loading and saving
 type ConfigService struct {
-	config     Config
+	config     Config // Merged with the included files
+	own        Config // As written in the config file, which is what Save writes
+	rules      *CompiledRules
+	loaded     bool // A valid config has been loaded, so errors keep it active
 	configPath string
+	httpClient *http.Client // Downloads rule pack subscriptions
+	clock      Clock
+	lock       sync.RWMutex // Guards config, own, rules, loaded and configPath
+	syncLock   sync.Mutex   // Serializes SyncSubscriptions
 }
 
-// NewConfigService creates a new ConfigService instance
+// NewConfigService creates a new ConfigService instance for the config file in ~/.brb:
+// config.json, config.yaml, config.yml or config.toml, whichever exists
 func NewConfigService() (*ConfigService, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
-	configPath := filepath.Join(homeDir, ".brb", "config.json")
+	return NewConfigServiceWithPath(findConfigFile(filepath.Join(homeDir, ".brb")))
+}
 
+// NewConfigServiceWithPath creates a new ConfigService for a custom config file (for testing)
+func NewConfigServiceWithPath(configPath string) (*ConfigService, error) {
 	service := &ConfigService{
 		configPath: configPath,
+		httpClient: &http.Client{Timeout: subscriptionTimeout},
+		clock:      realClock{},
 	}
 
 	// Create config directory if it doesn't exist
@@ -38,8 +54,8 @@ func NewConfigService() (*ConfigService, error) {
 			Browsers:          []BrowserConfig{},
 			DefaultBrowserURL: "",
 		}
-		service.SetConfig(emptyConfig)
-		if err := service.Save(); err != nil {
+		service.setConfig(emptyConfig)
+		if err := service.save(); err != nil {
 			return nil, err
 		}
 	}
@@ -49,9 +65,19 @@ func NewConfigService() (*ConfigService, error) {
 	return service, nil
 }
 
-// Load loads the configuration from disk
-// If the file doesn't exist, config remains empty (no error)
+// Load loads the configuration from disk and compiles its rules.
+// If the file doesn't exist, config remains empty (no error).
+// Files listed under include are merged in, see loadConfigWithIncludes.
+// If the file or an included file is invalid, the last valid config stays active and the error
+// lists every problem; when no valid config was loaded before, the valid rules are used.
 func (cs *ConfigService) Load() error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.load()
+}
+
+// load is Load with the lock held
+func (cs *ConfigService) load() error {
 	if cs.configPath == "" {
 		// No path set, config stays empty
 		return nil
@@ -66,66 +92,181 @@ func (cs *ConfigService) Load() error {
 		return err
 	}
 
-	// If file is empty, use empty config
-	if len(data) == 0 {
-		cs.config = Config{
-			Browsers:          []BrowserConfig{},
-			DefaultBrowserURL: "",
-		}
-		return nil
+	format := ConfigFormatOf(cs.configPath)
+	var config, own Config
+	var sources configSources
+	var errs ConfigErrors
+	data, err = configToJSON(format, data)
+	if err == nil {
+		config, own, sources, errs, err = loadConfigWithIncludes(cs.configPath, data)
 	}
-
-	if err := json.Unmarshal(data, &cs.config); err != nil {
+	if err != nil {
 		log.Printf("Invalid config at %s: %v", cs.configPath, err)
-		cs.config = Config{
-			Browsers:          []BrowserConfig{},
-			DefaultBrowserURL: "",
+		if !cs.loaded {
+			cs.setConfig(Config{
+				Browsers:          []BrowserConfig{},
+				DefaultBrowserURL: "",
+			})
 		}
-		return fmt.Errorf("invalid JSON in config file: %w", err)
+		return fmt.Errorf("invalid %s in config file: %w", format, err)
 	}
 
+	rules, err := CompileRules(config)
+	var ruleErrs ConfigErrors
+	if errors.As(err, &ruleErrs) {
+		sources.attribute(ruleErrs)
+		errs = append(errs, ruleErrs...)
+	}
+	if len(errs) > 0 {
+		log.Printf("Invalid rules in config at %s: %v", cs.configPath, errs)
+		if !cs.loaded {
+			cs.config, cs.rules = config, rules
+		}
+		cs.own = own // Changes made from the menu edit the file as it is now
+		return errs
+	}
+	cs.config, cs.own, cs.rules, cs.loaded = config, own, rules, true
 	return nil
 }
 
-// Save saves the configuration to disk
+// Save saves the configuration to disk in the format of the config file.
+// Entries merged in from included files are not written.
 func (cs *ConfigService) Save() error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.save()
+}
+
+// save is Save with the lock held
+func (cs *ConfigService) save() error {
 	// Create config directory if it doesn't exist
 	configDir := filepath.Dir(cs.configPath)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return err
 	}
 
-	data, err := json.MarshalIndent(cs.config, "", "  ")
+	data, err := encodeConfig(cs.own, ConfigFormatOf(cs.configPath))
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(cs.configPath, data, 0644)
 }
 
-// GetConfig returns the current configuration
+// GetConfig returns the current configuration, merged with the included files
 func (cs *ConfigService) GetConfig() Config {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
 	return cs.config
 }
 
-// SetConfig sets the configuration
+// GetRules returns the compiled rules of the current configuration
+func (cs *ConfigService) GetRules() *CompiledRules {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.compiledRules()
+}
+
+// GetConfigAndRules returns the current configuration and its compiled rules, both from the same Load
+func (cs *ConfigService) GetConfigAndRules() (Config, *CompiledRules) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.config, cs.compiledRules()
+}
+
+// compiledRules is GetRules with the lock held
+func (cs *ConfigService) compiledRules() *CompiledRules {
+	if cs.rules == nil {
+		cs.rules, _ = CompileRules(cs.config)
+	}
+	return cs.rules
+}
+
+// SetConfig sets the configuration of the config file. Its includes take effect on the next Load.
 func (cs *ConfigService) SetConfig(config Config) {
-	cs.config = config
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.setConfig(config)
+}
+
+// setConfig is SetConfig with the lock held
+func (cs *ConfigService) setConfig(config Config) {
+	cs.config, cs.own = config, config
+	cs.rules, _ = CompileRules(config)
 }
 
 // GetConfigPath returns the config file path
 func (cs *ConfigService) GetConfigPath() string {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
 	return cs.configPath
 }
 
 // SetDefaultBrowser sets the default browser and saves the configuration
 // It reloads the config first to ensure we don't lose any existing browser configurations
 func (cs *ConfigService) SetDefaultBrowser(browserPath string) error {
-	if err := cs.Load(); err != nil {
+	return cs.SetDefaultBrowserProfile(browserPath, "")
+}
+
+// SetDefaultBrowserProfile sets the default browser and the profile it opens URLs in, and saves the configuration.
+// Invalid rules don't stop the change; they are returned as ConfigErrors after it is saved.
+func (cs *ConfigService) SetDefaultBrowserProfile(browserPath string, profile string) error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if err := cs.loadForEdit(); err != nil {
+		return err
+	}
+	config := cs.own
+	config.DefaultBrowserURL = browserPath
+	config.DefaultBrowserProfile = profile
+	return cs.editConfigFile(config, func(doc *jsoncDocument) error {
+		if err := doc.setMember("defaultBrowserURL", browserPath); err != nil {
+			return err
+		}
+		if profile == "" {
+			return doc.removeMember("defaultBrowserProfile")
+		}
+		return doc.setMember("defaultBrowserProfile", profile)
+	})
+}
+
+// loadForEdit loads the config file before a change to it, with the lock held. Only a file that
+// cannot be read or parsed stops the change: with invalid rules or included files, the file as
+// written can still be edited, and the errors are reported by the load after the change.
+func (cs *ConfigService) loadForEdit() error {
+	var errs ConfigErrors
+	if err := cs.load(); err != nil && !errors.As(err, &errs) {
 		return fmt.Errorf("cannot load config file: %w", err)
 	}
-	cs.config.DefaultBrowserURL = browserPath
-	if err := cs.Save(); err != nil {
+	return nil
+}
+
+// editConfigFile saves a change to the config file and loads it again, with the lock held.
+// A JSON file is patched in place so its comments, the order of its fields and fields brb
+// doesn't know about are kept; other formats, and JSON files that can't be patched, are
+// rewritten from config.
+func (cs *ConfigService) editConfigFile(config Config, patch func(doc *jsoncDocument) error) error {
+	if ConfigFormatOf(cs.configPath) == FormatJSON {
+		if data, err := os.ReadFile(cs.configPath); err == nil && len(bytes.TrimSpace(data)) > 0 {
+			if doc, err := parseJSONCDocument(data); err == nil {
+				if err := patch(doc); err != nil {
+					return err
+				}
+				if err := writeFileAtomic(cs.configPath, doc.data); err != nil {
+					return fmt.Errorf("cannot save config: %w", err)
+				}
+				return cs.load()
+			}
+		}
+	}
+	return cs.saveOwn(config)
+}
+
+// saveOwn saves a changed config file and loads it again, so included files are merged back in.
+// The active config only changes if the saved file loads without errors. The lock must be held.
+func (cs *ConfigService) saveOwn(config Config) error {
+	cs.own = config
+	if err := cs.save(); err != nil {
 		return fmt.Errorf("cannot save config: %w", err)
 	}
-	return nil
+	return cs.load()
 }
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// safariFallbackURL is opened when neither a rule nor the config names a browser
+const safariFallbackURL = "/Applications/Safari.app"
+
+// webSchemes are the schemes a web browser opens; other schemes go to their own applications
+var webSchemes = map[string]bool{"http": true, "https": true, "file": true}
+
+// Where the browser of a decision came from when no rule named one
+const (
+	FallbackNone       = ""
+	FallbackDefaultApp = "defaultApp" // The application configured for the scheme in defaultApps
+	FallbackDefault    = "default"    // The default browser, for web URLs
+	FallbackSafari     = "safari"     // Safari, for web URLs when no default browser is set
+	FallbackUnhandled  = "unhandled"  // Nothing can open the URL; BrowserURL is empty
+)
+
+// RuleOutcome is the result of evaluating one rule for a URL
+type RuleOutcome string
+
+// Possible rule outcomes
+const (
+	RuleSelected         RuleOutcome = "selected"           // The rule decided the browser
+	RuleMatched          RuleOutcome = "matched"            // The rule matched, but another rule won
+	RuleNoMatch          RuleOutcome = "no match"           // No pattern, regex or matcher matched
+	RuleConditionsNotMet RuleOutcome = "conditions not met" // Source app, schedule or network did not hold
+	RuleExcluded         RuleOutcome = "excluded"           // An exclude pattern matched
+	RuleInvalid          RuleOutcome = "invalid"            // The rule has an invalid condition and never matches
+)
+
+// TraceCheck is one pattern, matcher or condition checked for a rule
+type TraceCheck struct {
+	Kind   string // e.g. "pattern", "regex", "matcher", "excludePattern", "sourceApps", "schedule", "network"
+	Value  string
+	Passed bool
+}
+
+// RuleTrace records how one rule was evaluated
+type RuleTrace struct {
+	Index      int
+	BrowserURL string
+	Priority   int
+	Checks     []TraceCheck
+	Outcome    RuleOutcome
+}
+
+// Decision describes which browser opens a URL and how that was decided
+type Decision struct {
+	Request       URLRequest       // The request as received
+	Stages        []URLStageResult // Unwrapping, short link expansion and rewrites
+	RemovedParams []string         // Tracking parameters removed before matching
+	MatchURL      string           // The URL the rules were matched against
+	OpenURL       string           // The URL handed to the browser
+	MatchMode     string
+	RuleIndex     int           // Index of the rule that decided, or -1
+	Rules         []RuleTrace   // Every rule and its checks; only filled by Explain
+	Scheme        string        // Lower-case scheme of the URL
+	BrowserURL    string        // Application that opens the URL; empty if none
+	BrowserURLs   []string      // Every application that opens the URL when the rule opens it in all of them; BrowserURL is the first
+	Launch        LaunchOptions // Profile and launch options for the browser
+	Fallback      string        // Set when no rule matched, or when nothing can open the URL
+	Ask           bool          // The user should choose the browser; BrowserURL opens the URL if they don't
+}
+
+// String formats the decision as a multi-line trace for logs
+func (d Decision) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "URL %s", d.Request.URL)
+	if d.Request.SourceApp != "" {
+		fmt.Fprintf(&b, " from %s", d.Request.SourceApp)
+	}
+	for _, stage := range d.Stages {
+		switch {
+		case stage.Err != nil:
+			fmt.Fprintf(&b, "\n  %s: failed: %v", stage.Stage, stage.Err)
+		case stage.Changed():
+			fmt.Fprintf(&b, "\n  %s: %s -> %s", stage.Stage, stage.Input, stage.Output)
+		}
+	}
+	if len(d.RemovedParams) > 0 {
+		fmt.Fprintf(&b, "\n  removed tracking parameters: %s", strings.Join(d.RemovedParams, ", "))
+	}
+	mode := d.MatchMode
+	if mode == "" {
+		mode = MatchModeFirst
+	}
+	fmt.Fprintf(&b, "\n  matching %s (%s match)", d.MatchURL, mode)
+	for _, rule := range d.Rules {
+		fmt.Fprintf(&b, "\n  rule %d -> %s (priority %d): %s", rule.Index, rule.BrowserURL, rule.Priority, rule.Outcome)
+		for _, check := range rule.Checks {
+			mark := "no"
+			if check.Passed {
+				mark = "yes"
+			}
+			fmt.Fprintf(&b, "\n    %s %s: %s", check.Kind, check.Value, mark)
+		}
+	}
+	switch d.Fallback {
+	case FallbackDefaultApp:
+		fmt.Fprintf(&b, "\n  no rule matched, using the default application for %s: %s", d.Scheme, d.BrowserURL)
+	case FallbackUnhandled:
+		if d.RuleIndex >= 0 {
+			fmt.Fprintf(&b, "\n  rule %d names no application and no default application is set for %s: links", d.RuleIndex, d.Scheme)
+		} else {
+			fmt.Fprintf(&b, "\n  no rule matched and no default application is set for %s: links", d.Scheme)
+		}
+	case FallbackDefault:
+		fmt.Fprintf(&b, "\n  no rule matched, using the default browser %s", d.BrowserURL)
+		if launch := d.Launch.String(); launch != "" {
+			fmt.Fprintf(&b, " (%s)", launch)
+		}
+	case FallbackSafari:
+		fmt.Fprintf(&b, "\n  no rule matched and no default browser is set, using %s", d.BrowserURL)
+	default:
+		if len(d.BrowserURLs) > 1 {
+			fmt.Fprintf(&b, "\n  rule %d selected %s", d.RuleIndex, strings.Join(d.BrowserURLs, ", "))
+		} else {
+			fmt.Fprintf(&b, "\n  rule %d selected %s", d.RuleIndex, d.BrowserURL)
+		}
+		if launch := d.Launch.String(); launch != "" {
+			fmt.Fprintf(&b, " (%s)", launch)
+		}
+	}
+	if d.Ask {
+		fmt.Fprintf(&b, "\n  asking which browser to use")
+	}
+	if d.OpenURL != d.MatchURL {
+		fmt.Fprintf(&b, "\n  opening %s", d.OpenURL)
+	}
+	return b.String()
+}
+
+// explainRules evaluates every rule for the request, recording each check, and returns
+// the index of the rule that decides (or -1). It selects the same rule as FindRuleForRequest.
+func (ps *PatternService) explainRules(rules *CompiledRules, request URLRequest, target canonicalURL) (int, []RuleTrace) {
+	mode := rules.config.MatchMode
+
+	eval := ps.newEvaluation(request)
+	bestIndex := -1
+	var bestSpec specificity
+	traces := make([]RuleTrace, 0, len(rules.rules))
+	for i := range rules.rules {
+		rule := &rules.rules[i]
+		trace := RuleTrace{Index: i, BrowserURL: strings.Join(rule.browsers, ", "), Priority: rule.config.Priority}
+		conditionsOK := traceConditions(rule, eval, &trace)
+		matched, spec := traceCriteria(rule.include, "", target, &trace)
+		excluded, _ := traceCriteria(rule.exclude, "exclude", target, &trace)
+
+		switch {
+		case rule.disabled:
+			trace.Outcome = RuleInvalid
+		case !conditionsOK:
+			trace.Outcome = RuleConditionsNotMet
+		case !matched && (rule.hasURLCriteria || !rule.hasConditions):
+			trace.Outcome = RuleNoMatch
+		case excluded:
+			trace.Outcome = RuleExcluded
+		default:
+			trace.Outcome = RuleMatched
+			spec.conditions += rule.conditions
+			if bestIndex == -1 || isBetterMatch(mode, rule.config, spec, rules.rules[bestIndex].config, bestSpec) {
+				bestIndex, bestSpec = i, spec
+			}
+		}
+		traces = append(traces, trace)
+	}
+	if bestIndex >= 0 {
+		traces[bestIndex].Outcome = RuleSelected
+	}
+	return bestIndex, traces
+}
+
+// traceConditions checks every condition of the rule and records the results
+func traceConditions(rule *compiledRule, eval *evaluation, trace *RuleTrace) bool {
+	ok := true
+	record := func(kind, value string, passed bool) {
+		trace.Checks = append(trace.Checks, TraceCheck{Kind: kind, Value: value, Passed: passed})
+		ok = ok && passed
+	}
+	if len(rule.config.SourceApps) > 0 {
+		record("sourceApps", strings.Join(rule.config.SourceApps, ", "), sourceAppMatches(rule.config.SourceApps, eval.request.SourceApp))
+	}
+	if rule.config.Schedule != nil {
+		record("schedule", describe(rule.config.Schedule), rule.schedule != nil && rule.schedule.active(eval.now))
+	}
+	if rule.config.Network != nil {
+		record("network", describe(rule.config.Network), rule.network != nil && rule.network.met(eval.snapshot()))
+	}
+	return ok
+}
+
+// traceCriteria checks every pattern, regex and matcher and records the results.
+// prefix names the list, e.g. "exclude" records "excludePattern" checks.
+func traceCriteria(criteria urlCriteria, prefix string, target canonicalURL, trace *RuleTrace) (bool, specificity) {
+	matched := false
+	var best specificity
+	record := func(kind, value string, passed bool, spec specificity) {
+		if prefix != "" {
+			kind = prefix + strings.ToUpper(kind[:1]) + kind[1:]
+		}
+		trace.Checks = append(trace.Checks, TraceCheck{Kind: kind, Value: value, Passed: passed})
+		if !passed {
+			return
+		}
+		if !matched || spec.compare(best) > 0 {
+			best = spec
+		}
+		matched = true
+	}
+	for _, pattern := range criteria.patterns {
+		record("pattern", fmt.Sprintf("%q", pattern.source), target.contains(pattern.text), pattern.spec)
+	}
+	for _, regex := range criteria.regexes {
+		record("regex", fmt.Sprintf("%q", regex.re.String()), target.matchRegex(regex.re), regex.spec)
+	}
+	for _, matcher := range criteria.matchers {
+		record("matcher", describe(matcher.source), matcher.matches(target.parsed), matcher.spec)
+	}
+	return matched, best
+}
+
+// describe formats a config value as compact JSON
+func describe(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
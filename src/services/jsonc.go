@@ -0,0 +1,540 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// stripJSONC turns JSONC (JSON with comments and trailing commas) into JSON by blanking the
+// comments and trailing commas. Offsets and line numbers stay the same, so errors point at the
+// right place.
+func stripJSONC(data []byte) []byte {
+	out := bytes.Clone(data)
+	lastComma := -1 // Offset of a comma that no value has followed yet
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"':
+			i = endOfJSONString(out, i) - 1
+			lastComma = -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := len(out)
+			if j := bytes.Index(out[i+2:], []byte("*/")); j >= 0 {
+				end = i + 2 + j + 2
+			}
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		case c == ',':
+			lastComma = i
+		case c == '}' || c == ']':
+			if lastComma >= 0 {
+				out[lastComma] = ' '
+			}
+			lastComma = -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			lastComma = -1
+		}
+	}
+	return out
+}
+
+// endOfJSONString returns the offset just past the string starting at start, or the end of the data
+func endOfJSONString(data []byte, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// jsoncNode is a value of a JSONC document and where it is in the text
+type jsoncNode struct {
+	kind  byte        // '{' for objects, '[' for arrays, 0 for other values
+	start int         // Offset of the first byte of the value
+	end   int         // Offset just past the value
+	items []jsoncItem // Members of an object or elements of an array, in order
+}
+
+// jsoncItem is a member of an object or an element of an array
+type jsoncItem struct {
+	key   string // Member name; empty for array elements
+	start int    // Offset of the member name, or of the element
+	value *jsoncNode
+}
+
+// jsoncParser reads the structure of a JSONC document. It checks the syntax only as far as
+// needed to find the values; the content is validated by decoding the stripped JSON.
+type jsoncParser struct {
+	data []byte
+	pos  int
+}
+
+// parseJSONC returns the root value of a JSONC document
+func parseJSONC(data []byte) (*jsoncNode, error) {
+	p := &jsoncParser{data: data}
+	p.skip()
+	root, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skip()
+	if p.pos < len(data) {
+		return nil, p.errorf("unexpected %q after the document", data[p.pos])
+	}
+	return root, nil
+}
+
+// skip moves past whitespace and comments
+func (p *jsoncParser) skip() {
+	for p.pos < len(p.data) {
+		rest := p.data[p.pos:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			p.pos++
+		case bytes.HasPrefix(rest, []byte("//")):
+			if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+				p.pos += i
+			} else {
+				p.pos = len(p.data)
+			}
+		case bytes.HasPrefix(rest, []byte("/*")):
+			if i := bytes.Index(rest[2:], []byte("*/")); i >= 0 {
+				p.pos += i + 4
+			} else {
+				p.pos = len(p.data)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// value parses the value at the current position
+func (p *jsoncParser) value() (*jsoncNode, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	node := &jsoncNode{start: p.pos}
+	switch c := p.data[p.pos]; c {
+	case '{', '[':
+		node.kind = c
+		closing := byte('}')
+		if c == '[' {
+			closing = ']'
+		}
+		p.pos++
+		for {
+			p.skip()
+			if p.pos < len(p.data) && p.data[p.pos] == closing {
+				p.pos++
+				break
+			}
+			item := jsoncItem{start: p.pos}
+			if c == '{' {
+				key, err := p.key()
+				if err != nil {
+					return nil, err
+				}
+				item.key = key
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			item.value = value
+			node.items = append(node.items, item)
+
+			p.skip()
+			if p.pos < len(p.data) && p.data[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			if p.pos < len(p.data) && p.data[p.pos] == closing {
+				p.pos++
+				break
+			}
+			return nil, p.errorf("expected , or %c", closing)
+		}
+	case '"':
+		p.pos = endOfJSONString(p.data, p.pos)
+	default:
+		for p.pos < len(p.data) && !strings.ContainsRune(" \t\r\n,:[]{}\"/", rune(p.data[p.pos])) {
+			p.pos++
+		}
+		if p.pos == node.start {
+			return nil, p.errorf("unexpected %q", c)
+		}
+	}
+	node.end = p.pos
+	return node, nil
+}
+
+// key parses a member name and the colon after it
+func (p *jsoncParser) key() (string, error) {
+	if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+		return "", p.errorf("expected a member name")
+	}
+	start := p.pos
+	p.pos = endOfJSONString(p.data, p.pos)
+	var key string
+	if err := json.Unmarshal(p.data[start:p.pos], &key); err != nil {
+		return "", p.errorf("invalid member name %s", p.data[start:p.pos])
+	}
+	p.skip()
+	if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+		return "", p.errorf("expected : after %q", key)
+	}
+	p.pos++
+	p.skip()
+	return key, nil
+}
+
+// errorf reports a syntax error with its line
+func (p *jsoncParser) errorf(format string, args ...any) error {
+	line := bytes.Count(p.data[:min(p.pos, len(p.data))], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// jsoncEdit replaces a range of a document's text
+type jsoncEdit struct {
+	start, end int
+	text       string
+}
+
+// jsoncDocument is a JSONC document whose root object can be edited without disturbing
+// the rest of the text: comments, the order of members and members brb doesn't know about stay.
+type jsoncDocument struct {
+	data   []byte
+	root   *jsoncNode
+	indent string // One level of indentation, as used by the document
+}
+
+// parseJSONCDocument parses a JSONC document whose root is an object
+func parseJSONCDocument(data []byte) (*jsoncDocument, error) {
+	doc := &jsoncDocument{data: data}
+	if err := doc.parse(); err != nil {
+		return nil, err
+	}
+	doc.indent = "  "
+	if len(doc.root.items) > 0 && doc.startsLine(doc.root.items[0].start) {
+		if indent := doc.lineIndent(doc.root.items[0].start); indent != "" {
+			doc.indent = indent
+		}
+	}
+	return doc, nil
+}
+
+// parse reads the structure of the current text
+func (d *jsoncDocument) parse() error {
+	root, err := parseJSONC(d.data)
+	if err != nil {
+		return err
+	}
+	if root.kind != '{' {
+		return fmt.Errorf("the config must be an object")
+	}
+	d.root = root
+	return nil
+}
+
+// setMember sets a member of the root object, adding it at the end if it is missing
+func (d *jsoncDocument) setMember(key string, value any) error {
+	if index := d.memberIndex(key); index >= 0 {
+		return d.replaceValue(d.root.items[index], value)
+	}
+	return d.insertItem(d.root, len(d.root.items), func(indent string, multiline bool) (string, error) {
+		name, _ := json.Marshal(key)
+		encoded, err := d.encode(value, indent, multiline)
+		return string(name) + ": " + encoded, err
+	})
+}
+
+// removeMember removes a member of the root object if it is there
+func (d *jsoncDocument) removeMember(key string) error {
+	if index := d.memberIndex(key); index >= 0 {
+		return d.removeItem(d.root, index)
+	}
+	return nil
+}
+
+// insertElement inserts a value into an array member of the root object; an index equal to
+// the length of the array appends. A missing or null member becomes an array holding the value.
+func (d *jsoncDocument) insertElement(key string, index int, value any) error {
+	list, err := d.array(key)
+	if err != nil || list == nil {
+		if err == nil {
+			err = d.setMember(key, []any{value})
+		}
+		return err
+	}
+	if index < 0 || index > len(list.items) {
+		return fmt.Errorf("%s has no position %d", key, index)
+	}
+	return d.insertItem(list, index, func(indent string, multiline bool) (string, error) {
+		return d.encode(value, indent, multiline)
+	})
+}
+
+// replaceElement replaces an element of an array member of the root object
+func (d *jsoncDocument) replaceElement(key string, index int, value any) error {
+	list, err := d.array(key)
+	if err == nil && (list == nil || index < 0 || index >= len(list.items)) {
+		err = fmt.Errorf("%s has no element %d", key, index)
+	}
+	if err != nil {
+		return err
+	}
+	return d.replaceValue(list.items[index], value)
+}
+
+// removeElement removes an element of an array member of the root object
+func (d *jsoncDocument) removeElement(key string, index int) error {
+	list, err := d.array(key)
+	if err == nil && (list == nil || index < 0 || index >= len(list.items)) {
+		err = fmt.Errorf("%s has no element %d", key, index)
+	}
+	if err != nil {
+		return err
+	}
+	return d.removeItem(list, index)
+}
+
+// memberIndex returns the index of the last member of the root object with a name, or -1.
+// The last one is used because it is the one that takes effect when a name is repeated.
+func (d *jsoncDocument) memberIndex(key string) int {
+	for i := len(d.root.items) - 1; i >= 0; i-- {
+		if d.root.items[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// array returns an array member of the root object, or nil if it is missing or null
+func (d *jsoncDocument) array(key string) (*jsoncNode, error) {
+	index := d.memberIndex(key)
+	if index < 0 {
+		return nil, nil
+	}
+	value := d.root.items[index].value
+	if value.kind == '[' {
+		return value, nil
+	}
+	if string(d.data[value.start:value.end]) == "null" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s is not a list", key)
+}
+
+// replaceValue replaces the value of a member or element, indenting it like the item
+func (d *jsoncDocument) replaceValue(item jsoncItem, value any) error {
+	encoded, err := d.encode(value, d.lineIndent(item.start), d.startsLine(item.start))
+	if err != nil {
+		return err
+	}
+	return d.apply(jsoncEdit{item.value.start, item.value.end, encoded})
+}
+
+// insertItem inserts a member or element into an object or array before the item at index,
+// or at the end. text renders the item for an indentation and whether it goes on its own line.
+func (d *jsoncDocument) insertItem(container *jsoncNode, index int, text func(indent string, multiline bool) (string, error)) error {
+	items := container.items
+	multiline := len(items) == 0 || d.startsLine(items[0].start)
+	indent := d.lineIndent(container.start) + d.indent
+	if len(items) > 0 && multiline {
+		indent = d.lineIndent(items[0].start)
+	}
+	item, err := text(indent, multiline)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(items) == 0:
+		// Put the item on its own line, before the closing bracket and after any comments
+		closing := container.end - 1
+		start := closing
+		for start > container.start+1 && isJSONSpace(d.data[start-1]) {
+			start--
+		}
+		return d.apply(jsoncEdit{start, closing, "\n" + indent + item + "\n" + d.lineIndent(container.start)})
+	case index < len(items) && multiline:
+		// Above the next item and the comment lines that belong to it
+		at := d.leadingStart(items[index].start)
+		return d.apply(jsoncEdit{at, at, indent + item + ",\n"})
+	case index < len(items):
+		at := items[index].start
+		return d.apply(jsoncEdit{at, at, item + ", "})
+	case !multiline:
+		at := items[len(items)-1].value.end
+		return d.apply(jsoncEdit{at, at, ", " + item})
+	}
+
+	// After the last item, past its comma and any comment on the same line
+	last := items[len(items)-1].value.end
+	comma, lineEnd := d.afterItem(last)
+	if comma >= 0 {
+		return d.apply(jsoncEdit{lineEnd, lineEnd, "\n" + indent + item + ","})
+	}
+	return d.apply(jsoncEdit{last, last, ","}, jsoncEdit{lineEnd, lineEnd, "\n" + indent + item})
+}
+
+// removeItem removes a member or element with its comma, and the lines it was on if it had
+// lines of its own, including the comment lines above it
+func (d *jsoncDocument) removeItem(container *jsoncNode, index int) error {
+	items := container.items
+	item := items[index]
+	ownLines := d.startsLine(item.start)
+
+	if len(items) == 1 {
+		return d.apply(jsoncEdit{container.start + 1, container.end - 1, ""})
+	}
+	if index < len(items)-1 {
+		// Up to the next item
+		start, next := item.start, items[index+1].start
+		if ownLines && d.startsLine(next) {
+			start, next = d.leadingStart(start), d.leadingStart(next)
+		}
+		return d.apply(jsoncEdit{start, next, ""})
+	}
+
+	// The last item goes with its own trailing comma, or else with the comma after the previous
+	// item, so the list keeps having or not having a trailing comma
+	previousComma, _ := d.afterItem(items[index-1].value.end)
+	end := item.value.end
+	if comma, _ := d.afterItem(end); comma >= 0 {
+		end, previousComma = comma+1, -1
+	}
+	if !ownLines {
+		start := item.start
+		if previousComma >= 0 {
+			start = previousComma
+		}
+		return d.apply(jsoncEdit{start, end, ""})
+	}
+	start := d.leadingStart(item.start)
+	if _, lineEnd := d.afterItem(end); lineEnd < len(d.data) && d.data[lineEnd] == '\n' {
+		end = lineEnd + 1
+	}
+	edits := []jsoncEdit{{start, end, ""}}
+	if previousComma >= 0 && previousComma < start {
+		edits = append(edits, jsoncEdit{previousComma, previousComma + 1, ""})
+	}
+	return d.apply(edits...)
+}
+
+// afterItem looks past the end of an item's value on the same line. It returns the offset of the
+// comma that follows it, or -1, and the end of the line, after any comment, or the offset of
+// the next token on the line.
+func (d *jsoncDocument) afterItem(end int) (comma int, lineEnd int) {
+	comma = -1
+	i := end
+	for i < len(d.data) {
+		rest := d.data[i:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r':
+			i++
+		case rest[0] == ',' && comma < 0:
+			comma = i
+			i++
+		case bytes.HasPrefix(rest, []byte("//")):
+			return comma, d.lineEnd(i)
+		case bytes.HasPrefix(rest, []byte("/*")) && bytes.Contains(rest[:d.lineEnd(i)-i], []byte("*/")):
+			i += bytes.Index(rest, []byte("*/")) + 2
+		default:
+			return comma, i
+		}
+	}
+	return comma, i
+}
+
+// apply makes edits to the text and reads its structure again. Text inserted at the same
+// offset ends up in the order of the edits.
+func (d *jsoncDocument) apply(edits ...jsoncEdit) error {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	data := d.data
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		data = append(data[:edit.start:edit.start], append([]byte(edit.text), data[edit.end:]...)...)
+	}
+	previous := d.data
+	d.data = data
+	if err := d.parse(); err != nil {
+		d.data = previous
+		return fmt.Errorf("cannot edit config: %w", err)
+	}
+	return nil
+}
+
+// encode renders a value as JSON, indented to continue at indent, or on one line
+func (d *jsoncDocument) encode(value any, indent string, multiline bool) (string, error) {
+	var data []byte
+	var err error
+	if multiline {
+		data, err = json.MarshalIndent(value, indent, d.indent)
+	} else {
+		data, err = json.Marshal(value)
+	}
+	return string(data), err
+}
+
+// lineStart returns the offset of the start of the line containing pos
+func (d *jsoncDocument) lineStart(pos int) int {
+	return bytes.LastIndexByte(d.data[:pos], '\n') + 1
+}
+
+// lineEnd returns the offset of the newline ending the line containing pos, or the end of the data
+func (d *jsoncDocument) lineEnd(pos int) int {
+	if i := bytes.IndexByte(d.data[pos:], '\n'); i >= 0 {
+		return pos + i
+	}
+	return len(d.data)
+}
+
+// lineIndent returns the whitespace at the start of the line containing pos
+func (d *jsoncDocument) lineIndent(pos int) string {
+	start := d.lineStart(pos)
+	end := start
+	for end < len(d.data) && (d.data[end] == ' ' || d.data[end] == '\t') {
+		end++
+	}
+	return string(d.data[start:end])
+}
+
+// startsLine reports whether only whitespace comes before pos on its line
+func (d *jsoncDocument) startsLine(pos int) bool {
+	return len(bytes.TrimSpace(d.data[d.lineStart(pos):pos])) == 0
+}
+
+// leadingStart returns the start of the line of pos, moved up over the "//" comment lines directly above it
+func (d *jsoncDocument) leadingStart(pos int) int {
+	start := d.lineStart(pos)
+	for start > 0 {
+		previous := d.lineStart(start - 1)
+		if !bytes.HasPrefix(bytes.TrimSpace(d.data[previous:start]), []byte("//")) {
+			break
+		}
+		start = previous
+	}
+	return start
+}
+
+// isJSONSpace reports whether a byte is JSON whitespace
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// BrowserFamily groups browsers that take the same command line arguments
+type BrowserFamily string
+
+// Browser families with profile support
+const (
+	BrowserFamilyChromium BrowserFamily = "chromium" // Chrome, Edge, Brave, Vivaldi, Opera, Chromium
+	BrowserFamilyFirefox  BrowserFamily = "firefox"  // Firefox and its forks
+	BrowserFamilyOther    BrowserFamily = "other"    // Safari and every other application
+)
+
+// browserFamilies maps lower-case application names to their family
+var browserFamilies = map[string]BrowserFamily{
+	"google chrome":             BrowserFamilyChromium,
+	"google chrome beta":        BrowserFamilyChromium,
+	"google chrome dev":         BrowserFamilyChromium,
+	"google chrome canary":      BrowserFamilyChromium,
+	"chrome":                    BrowserFamilyChromium,
+	"chrome beta":               BrowserFamilyChromium,
+	"chrome dev":                BrowserFamilyChromium,
+	"chrome canary":             BrowserFamilyChromium,
+	"chromium":                  BrowserFamilyChromium,
+	"microsoft edge":            BrowserFamilyChromium,
+	"microsoft edge beta":       BrowserFamilyChromium,
+	"microsoft edge dev":        BrowserFamilyChromium,
+	"microsoft edge canary":     BrowserFamilyChromium,
+	"edge":                      BrowserFamilyChromium,
+	"edge beta":                 BrowserFamilyChromium,
+	"edge dev":                  BrowserFamilyChromium,
+	"edge canary":               BrowserFamilyChromium,
+	"brave browser":             BrowserFamilyChromium,
+	"brave browser beta":        BrowserFamilyChromium,
+	"vivaldi":                   BrowserFamilyChromium,
+	"opera":                     BrowserFamilyChromium,
+	"firefox":                   BrowserFamilyFirefox,
+	"firefox developer edition": BrowserFamilyFirefox,
+	"firefox nightly":           BrowserFamilyFirefox,
+	"librewolf":                 BrowserFamilyFirefox,
+	"waterfox":                  BrowserFamilyFirefox,
+	"zen browser":               BrowserFamilyFirefox,
+}
+
+// LaunchOptions control how a browser is started for a URL
+type LaunchOptions struct {
+	Profile string // Browser profile; the profile directory for Chromium browsers, the profile name for Firefox
+	LaunchConfig
+}
+
+// NewLaunchOptions combines a profile and an optional launch block
+func NewLaunchOptions(profile string, launch *LaunchConfig) LaunchOptions {
+	opts := LaunchOptions{Profile: profile}
+	if launch != nil {
+		opts.LaunchConfig = *launch
+	}
+	return opts
+}
+
+// String lists the options that are set, e.g. "profile Work, private window"
+func (o LaunchOptions) String() string {
+	var parts []string
+	if o.Profile != "" {
+		parts = append(parts, "profile "+o.Profile)
+	}
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{{o.Private, "private window"}, {o.NewWindow, "new window"}, {o.App, "app window"}, {o.Background, "background"}} {
+		if option.set {
+			parts = append(parts, option.name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BrowserFamilyOf returns the family of the browser at the given application path
+func BrowserFamilyOf(browserPath string) BrowserFamily {
+	if family, ok := browserFamilies[browserName(browserPath)]; ok {
+		return family
+	}
+	return BrowserFamilyOther
+}
+
+// browserName returns the lower-case application name of a browser path, e.g. "google chrome"
+func browserName(browserPath string) string {
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(strings.TrimRight(browserPath, "/")), ".app"))
+}
+
+// BuildLaunchArgs returns the arguments for macOS's open command that open a URL in a browser
+// with the given options, and the names of the options the browser does not support.
+// Unsupported options are left out; the URL still opens.
+func BuildLaunchArgs(browserPath string, url string, opts LaunchOptions) (args []string, ignored []string) {
+	if opts.Background {
+		args = append(args, "-g") // Don't bring the browser to the front
+	}
+
+	var browserArgs []string
+	switch BrowserFamilyOf(browserPath) {
+	case BrowserFamilyChromium:
+		if opts.Profile != "" {
+			browserArgs = append(browserArgs, "--profile-directory="+opts.Profile)
+		}
+		if opts.Private {
+			browserArgs = append(browserArgs, chromiumPrivateFlag(browserPath))
+		}
+		if opts.NewWindow {
+			browserArgs = append(browserArgs, "--new-window")
+		}
+		if opts.App {
+			browserArgs = append(browserArgs, "--app="+url)
+		} else if len(browserArgs) > 0 {
+			browserArgs = append(browserArgs, url)
+		}
+	case BrowserFamilyFirefox:
+		if opts.App {
+			ignored = append(ignored, "app window")
+		}
+		if opts.Profile != "" {
+			browserArgs = append(browserArgs, "-P", opts.Profile)
+		}
+		switch {
+		case opts.Private:
+			browserArgs = append(browserArgs, "--private-window", url)
+		case opts.NewWindow:
+			browserArgs = append(browserArgs, "--new-window", url)
+		case len(browserArgs) > 0:
+			browserArgs = append(browserArgs, "--new-tab", url)
+		}
+	default:
+		for _, option := range []struct {
+			set  bool
+			name string
+		}{{opts.Profile != "", "profile"}, {opts.Private, "private window"}, {opts.NewWindow, "new window"}, {opts.App, "app window"}} {
+			if option.set {
+				ignored = append(ignored, option.name)
+			}
+		}
+	}
+
+	if len(browserArgs) == 0 {
+		return append(args, "-a", browserPath, url), ignored
+	}
+	// -n starts a new instance so the arguments reach the browser even when it is running;
+	// the browser then hands the URL to its running instance.
+	args = append(args, "-n", "-a", browserPath, "--args")
+	return append(args, browserArgs...), ignored
+}
+
+// chromiumPrivateFlag returns the flag that opens a private window in a Chromium browser
+func chromiumPrivateFlag(browserPath string) string {
+	name := browserName(browserPath)
+	switch {
+	case strings.HasPrefix(name, "microsoft edge") || strings.HasPrefix(name, "edge"):
+		return "--inprivate"
+	case strings.HasPrefix(name, "opera"):
+		return "--private"
+	default:
+		return "--incognito"
+	}
+}
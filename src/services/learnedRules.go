@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// LearnedRule is a rule added by remembering a browser choice
+type LearnedRule struct {
+	Index      int    // Index of the rule in the browsers list
+	Domain     string // Registrable domain (or host, for hosts without one) the rule matches
+	BrowserURL string
+	Profile    string
+}
+
+// AddLearnedRule remembers a browser choice for the domain of a URL and saves the configuration.
+// An existing learned rule for the domain is updated. A new rule goes in front of the first rule
+// of the config file that matches the URL so that it takes effect, or at the end of the config
+// file's rules, which still comes before the rules of included files.
+// It reloads the config first so hand edits are kept. Invalid rules don't stop the change; they
+// are returned as ConfigErrors together with the saved rule.
+func (cs *ConfigService) AddLearnedRule(rawURL string, browserPath string, profile string) (BrowserConfig, error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if err := cs.loadForEdit(); err != nil {
+		return BrowserConfig{}, err
+	}
+	matcher, domain, err := learnedMatcher(rawURL)
+	if err != nil {
+		return BrowserConfig{}, err
+	}
+
+	config := cs.own
+	config.Browsers = slices.Clone(config.Browsers)
+	rule := BrowserConfig{Matchers: []URLMatcher{matcher}, BrowserURL: browserPath, Profile: profile, Learned: true}
+	var patch func(doc *jsoncDocument) error
+	// The config file's rules come first in the merged rules, so their indexes are the same
+	if index := learnedRuleIndex(config.Browsers, domain); index >= 0 {
+		rule.Priority = config.Browsers[index].Priority
+		config.Browsers[index] = rule
+		patch = func(doc *jsoncDocument) error { return doc.replaceElement("browsers", index, rule) }
+	} else {
+		index := len(config.Browsers)
+		if match := cs.compiledRules().firstURLMatch(canonicalize(rawURL)); match >= 0 {
+			rule.Priority = cs.config.Browsers[match].Priority
+			index = min(match, index)
+		}
+		config.Browsers = slices.Insert(config.Browsers, index, rule)
+		patch = func(doc *jsoncDocument) error { return doc.insertElement("browsers", index, rule) }
+	}
+
+	err = cs.editConfigFile(config, patch)
+	var errs ConfigErrors
+	if err != nil && !errors.As(err, &errs) {
+		return BrowserConfig{}, err
+	}
+	return rule, err
+}
+
+// LearnedRules lists the learned rules of the config file
+func (cs *ConfigService) LearnedRules() []LearnedRule {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	var learned []LearnedRule
+	for i, rule := range cs.own.Browsers {
+		if domain := learnedDomain(rule); domain != "" {
+			learned = append(learned, LearnedRule{Index: i, Domain: domain, BrowserURL: rule.BrowserURL, Profile: rule.Profile})
+		}
+	}
+	return learned
+}
+
+// RemoveLearnedRule removes the learned rule for a domain and saves the configuration.
+// It reloads the config first so hand edits are kept. Invalid rules are returned as
+// ConfigErrors after the change is saved.
+func (cs *ConfigService) RemoveLearnedRule(domain string) error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if err := cs.loadForEdit(); err != nil {
+		return err
+	}
+	index := learnedRuleIndex(cs.own.Browsers, canonicalHost(domain))
+	if index < 0 {
+		return fmt.Errorf("no learned rule for %s", domain)
+	}
+
+	config := cs.own
+	config.Browsers = slices.Delete(slices.Clone(config.Browsers), index, index+1)
+	return cs.editConfigFile(config, func(doc *jsoncDocument) error {
+		return doc.removeElement("browsers", index)
+	})
+}
+
+// learnedMatcher returns the matcher and domain a learned rule for the URL uses: its
+// registrable domain, or the exact host for hosts such as localhost and IP addresses
+func learnedMatcher(rawURL string) (URLMatcher, string, error) {
+	target := canonicalize(rawURL)
+	if target.parsed == nil || target.parsed.Hostname() == "" {
+		return URLMatcher{}, "", errors.New("cannot remember a choice for a URL without a host")
+	}
+	host := target.parsed.Hostname()
+	if net.ParseIP(host) != nil {
+		return URLMatcher{Host: host}, host, nil
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return URLMatcher{Domain: domain}, domain, nil
+	}
+	return URLMatcher{Host: host}, host, nil
+}
+
+// learnedDomain returns the domain of a learned rule, or "" if the rule was not learned
+func learnedDomain(rule BrowserConfig) string {
+	if !rule.Learned || len(rule.Matchers) != 1 {
+		return ""
+	}
+	if rule.Matchers[0].Domain != "" {
+		return canonicalHost(rule.Matchers[0].Domain)
+	}
+	return canonicalHost(rule.Matchers[0].Host)
+}
+
+// learnedRuleIndex returns the index of the learned rule for a domain, or -1
+func learnedRuleIndex(rules []BrowserConfig, domain string) int {
+	return slices.IndexFunc(rules, func(rule BrowserConfig) bool {
+		return learnedDomain(rule) == domain
+	})
+}
+
+// firstURLMatch returns the index of the first rule whose patterns match the URL and whose
+// excludes don't, regardless of its conditions, or -1
+func (cr *CompiledRules) firstURLMatch(target canonicalURL) int {
+	for i := range cr.rules {
+		rule := &cr.rules[i]
+		if rule.disabled || !rule.hasURLCriteria {
+			continue
+		}
+		if matched, _ := criteriaMatch(rule.include, target, false); !matched {
+			continue
+		}
+		if excluded, _ := criteriaMatch(rule.exclude, target, false); excluded {
+			continue
+		}
+		return i
+	}
+	return -1
+}
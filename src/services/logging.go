@@ -0,0 +1,32 @@
+package services
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Log levels accepted in the config
+const (
+	LogLevelInfo  = "info"
+	LogLevelDebug = "debug"
+)
+
+// debugLogging is set when the config asks for debug output
+var debugLogging atomic.Bool
+
+// SetLogLevel enables or disables debug logging; unknown levels fall back to info
+func SetLogLevel(level string) {
+	debugLogging.Store(level == LogLevelDebug)
+}
+
+// DebugEnabled reports whether debug logging is on, so callers can skip expensive work
+func DebugEnabled() bool {
+	return debugLogging.Load()
+}
+
+// Debugf logs a message only when debug logging is on
+func Debugf(format string, args ...any) {
+	if debugLogging.Load() {
+		log.Printf("[debug] "+format, args...)
+	}
+}
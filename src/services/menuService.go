@@ -1,9 +1,14 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/getlantern/systray"
 )
@@ -11,8 +16,8 @@ import (
 // MenuService handles the menu bar setup and interactions
 type MenuService struct {
 	configPath            string
-	urlChan               chan string
-	handleURL             func(string)
+	urlChan               chan URLRequest
+	handleURL             func(URLRequest)
 	configService         *ConfigService
 	onConfigUpdated       func() // Callback to reload config when default browser is changed
 	defaultBrowserService *DefaultBrowserService
@@ -21,10 +26,20 @@ type MenuService struct {
 	mSetDefault           *systray.MenuItem            // Parent menu item for "Set Default Browser"
 	mConfigError          *systray.MenuItem            // Menu item shown when config has errors
 	configError           string                       // Current config error message
+	chooser               *ChooserService              // Links waiting for a browser choice; nil if asking is not set up
+	mPending              *systray.MenuItem            // Parent menu item for links waiting for a choice
+	pendingMenuItems      []*systray.MenuItem          // Submenu items of mPending, hidden on every update
+	pendingLock           sync.Mutex                   // Guards mPending and pendingMenuItems
+	mLearned              *systray.MenuItem            // Parent menu item for learned rules
+	learnedMenuItems      []*systray.MenuItem          // Submenu items of mLearned, hidden on every update
+	learnedLock           sync.Mutex                   // Guards mLearned and learnedMenuItems
+	mSubscriptions        *systray.MenuItem            // Parent menu item for subscribed rule packs
+	subscriptionMenuItems []*systray.MenuItem          // Submenu items of mSubscriptions, hidden on every update
+	subscriptionLock      sync.Mutex                   // Guards mSubscriptions and subscriptionMenuItems
 }
 
 // NewMenuService creates a new MenuService instance
-func NewMenuService(configPath string, urlChan chan string, handleURL func(string), configService *ConfigService, onConfigUpdated func(), defaultBrowserService *DefaultBrowserService) *MenuService {
+func NewMenuService(configPath string, urlChan chan URLRequest, handleURL func(URLRequest), configService *ConfigService, onConfigUpdated func(), defaultBrowserService *DefaultBrowserService) *MenuService {
 	return &MenuService{
 		configPath:            configPath,
 		urlChan:               urlChan,
@@ -35,6 +50,12 @@ func NewMenuService(configPath string, urlChan chan string, handleURL func(strin
 	}
 }
 
+// SetChooser connects the chooser whose pending links are listed in the menu
+func (ms *MenuService) SetChooser(chooser *ChooserService) {
+	ms.chooser = chooser
+	chooser.SetOnChange(ms.updatePendingMenuItems)
+}
+
 // OnReady sets up the menu bar when systray is ready
 func (ms *MenuService) OnReady(icon []byte) {
 	systray.SetIcon(icon)
@@ -56,10 +77,22 @@ func (ms *MenuService) OnReady(icon []byte) {
 	ms.mConfigError.Hide()
 	systray.AddSeparator()
 
+	// Links waiting for a browser choice (hidden while there are none)
+	ms.pendingLock.Lock()
+	ms.mPending = systray.AddMenuItem("Pending link", "Choose a browser for links waiting to open")
+	ms.mPending.Hide()
+	ms.pendingLock.Unlock()
+
 	mSetAsDefault := systray.AddMenuItem("Set as Default Browser", "Request this app to be the default browser")
 	systray.AddSeparator()
 	mSetDefault := systray.AddMenuItem("Set Default Browser", "Choose default browser for all requests")
 	systray.AddSeparator()
+	ms.learnedLock.Lock()
+	ms.mLearned = systray.AddMenuItem("Learned Rules", "Browser choices remembered for domains")
+	ms.learnedLock.Unlock()
+	ms.subscriptionLock.Lock()
+	ms.mSubscriptions = systray.AddMenuItem("Rule Packs", "Rule packs subscribed to in the config file")
+	ms.subscriptionLock.Unlock()
 	mReloadConfig := systray.AddMenuItem("Reload Config", "Reload configuration from disk")
 	mConfig := systray.AddMenuItem("Go to Config File", "Open config file in Finder")
 
@@ -70,13 +103,16 @@ func (ms *MenuService) OnReady(icon []byte) {
 
 	// Create initial submenu items
 	ms.updateBrowserMenuItems()
+	ms.updatePendingMenuItems()
+	ms.UpdateLearnedMenuItems()
+	ms.UpdateSubscriptionMenuItems()
 
 	// Handle menu item clicks
 	go func() {
 		for {
 			select {
-			case url := <-ms.urlChan:
-				ms.handleURL(url)
+			case request := <-ms.urlChan:
+				ms.handleURL(request)
 			case <-mQuit.ClickedCh:
 				systray.Quit()
 				return
@@ -109,7 +145,8 @@ func (ms *MenuService) updateBrowserMenuItems() {
 	}
 	ms.browserMenuItems = make(map[*systray.MenuItem]string)
 
-	currentDefault := ms.configService.GetConfig().DefaultBrowserURL
+	config := ms.configService.GetConfig()
+	currentDefault, currentProfile := config.DefaultBrowserURL, config.DefaultBrowserProfile
 
 	if len(ms.browsers) == 0 {
 		mNoBrowsers := ms.mSetDefault.AddSubMenuItem("No browsers detected", "")
@@ -122,23 +159,256 @@ func (ms *MenuService) updateBrowserMenuItems() {
 		if browser.Path == currentDefault {
 			menuText += " [default]"
 		}
-		menuItem := ms.mSetDefault.AddSubMenuItem(menuText, "Set as default browser")
+		if len(browser.Profiles) == 0 {
+			menuItem := ms.mSetDefault.AddSubMenuItem(menuText, "Set as default browser")
+			ms.browserMenuItems[menuItem] = browser.Path
+			ms.handleDefaultBrowserClicks(menuItem, browser.Path, "")
+			continue
+		}
+
+		// Browsers with profiles get a submenu with one entry per profile
+		menuItem := ms.mSetDefault.AddSubMenuItem(menuText, "Choose a profile")
 		ms.browserMenuItems[menuItem] = browser.Path
+		for _, profile := range browser.Profiles {
+			profileText := profile.Name
+			if browser.Path == currentDefault && profile.ID == currentProfile {
+				profileText += " [default]"
+			}
+			profileItem := menuItem.AddSubMenuItem(profileText, fmt.Sprintf("Set %s (%s) as default browser", browser.Name, profile.Name))
+			ms.handleDefaultBrowserClicks(profileItem, browser.Path, profile.ID)
+		}
+	}
+}
+
+// handleDefaultBrowserClicks makes a menu item set the default browser and profile
+func (ms *MenuService) handleDefaultBrowserClicks(item *systray.MenuItem, path string, profile string) {
+	go func() {
+		for range item.ClickedCh {
+			err := ms.configService.SetDefaultBrowserProfile(path, profile)
+			var ruleErrs ConfigErrors
+			if err != nil && !errors.As(err, &ruleErrs) {
+				ms.ShowConfigError(fmt.Sprintf("Cannot set default browser: %v", err))
+				continue
+			}
+			ms.configSaved(err)
+			ms.updateBrowserMenuItems()
+		}
+	}()
+}
+
+// configSaved applies a change saved from the menu. Invalid rules elsewhere in the config
+// don't stop a change from being saved; ruleErrs lists them.
+func (ms *MenuService) configSaved(ruleErrs error) {
+	if ms.onConfigUpdated != nil {
+		ms.onConfigUpdated() // Reloads the config and shows or clears its errors
+		return
+	}
+	if ruleErrs != nil {
+		ms.ShowConfigError(ruleErrs.Error())
+	} else {
+		ms.ClearConfigError()
+	}
+}
+
+// updatePendingMenuItems lists the links waiting for a choice, each with the detected browsers
+// and their profiles, and a "Cancel" entry
+func (ms *MenuService) updatePendingMenuItems() {
+	ms.pendingLock.Lock()
+	defer ms.pendingLock.Unlock()
+	if ms.mPending == nil || ms.chooser == nil {
+		return
+	}
+	for _, menuItem := range ms.pendingMenuItems {
+		menuItem.Hide()
+	}
+	ms.pendingMenuItems = nil
+
+	links := ms.chooser.Pending()
+	if len(links) == 0 {
+		ms.mPending.Hide()
+		return
+	}
+	if len(links) == 1 {
+		ms.mPending.SetTitle("Pending link")
+	} else {
+		ms.mPending.SetTitle(fmt.Sprintf("Pending links (%d)", len(links)))
+	}
+	ms.mPending.Show()
+
+	for _, link := range links {
+		linkItem := ms.mPending.AddSubMenuItem(truncateMenuText(link.Decision.OpenURL, 60), link.Decision.OpenURL)
+		ms.pendingMenuItems = append(ms.pendingMenuItems, linkItem)
+		for _, browser := range ms.browsers {
+			browserText := browser.Name
+			if browser.Path == link.Decision.BrowserURL {
+				browserText += " [default]"
+			}
+			if len(browser.Profiles) == 0 {
+				ms.handlePendingChoice(linkItem.AddSubMenuItem(browserText, "Open the link in "+browser.Name), link.ID, browser.Path, "")
+				continue
+			}
+			browserItem := linkItem.AddSubMenuItem(browserText, "Choose a profile")
+			for _, profile := range browser.Profiles {
+				ms.handlePendingChoice(browserItem.AddSubMenuItem(profile.Name, fmt.Sprintf("Open the link in %s (%s)", browser.Name, profile.Name)), link.ID, browser.Path, profile.ID)
+			}
+		}
+		if _, domain, err := learnedMatcher(link.Decision.MatchURL); err == nil {
+			rememberItem := linkItem.AddSubMenuItemCheckbox("Remember for "+domain, "Always open "+domain+" in the browser chosen next", link.Remember)
+			go func(item *systray.MenuItem, id int) {
+				for range item.ClickedCh {
+					remember := !item.Checked()
+					if ms.chooser.SetRemember(id, remember) != nil {
+						continue
+					}
+					if remember {
+						item.Check()
+					} else {
+						item.Uncheck()
+					}
+				}
+			}(rememberItem, link.ID)
+		}
+		cancelItem := linkItem.AddSubMenuItem("Cancel", "Don't open the link")
+		go func(item *systray.MenuItem, id int) {
+			for range item.ClickedCh {
+				_ = ms.chooser.Cancel(id)
+			}
+		}(cancelItem, link.ID)
+	}
+}
+
+// UpdateLearnedMenuItems lists the learned rules, each with a "Remove" entry
+func (ms *MenuService) UpdateLearnedMenuItems() {
+	ms.learnedLock.Lock()
+	defer ms.learnedLock.Unlock()
+	if ms.mLearned == nil {
+		return
+	}
+	for _, menuItem := range ms.learnedMenuItems {
+		menuItem.Hide()
+	}
+	ms.learnedMenuItems = nil
 
-		go func(item *systray.MenuItem, path string) {
+	learned := ms.configService.LearnedRules()
+	if len(learned) == 0 {
+		mNone := ms.mLearned.AddSubMenuItem("No learned rules", "Tick \"Remember for\" when choosing a browser for a pending link")
+		mNone.Disable()
+		ms.learnedMenuItems = append(ms.learnedMenuItems, mNone)
+		return
+	}
+	for _, rule := range learned {
+		browser := strings.TrimSuffix(filepath.Base(rule.BrowserURL), ".app")
+		if rule.Profile != "" {
+			browser += " (" + rule.Profile + ")"
+		}
+		ruleItem := ms.mLearned.AddSubMenuItem(rule.Domain+" → "+browser, rule.BrowserURL)
+		ms.learnedMenuItems = append(ms.learnedMenuItems, ruleItem)
+		removeItem := ruleItem.AddSubMenuItem("Remove", "Forget the browser for "+rule.Domain)
+		go func(item *systray.MenuItem, domain string) {
 			for range item.ClickedCh {
-				if err := ms.configService.SetDefaultBrowser(path); err != nil {
-					ms.ShowConfigError(fmt.Sprintf("Cannot set default browser: %v", err))
+				err := ms.configService.RemoveLearnedRule(domain)
+				var ruleErrs ConfigErrors
+				if err != nil && !errors.As(err, &ruleErrs) {
+					ms.ShowConfigError(fmt.Sprintf("Cannot remove learned rule: %v", err))
 					continue
 				}
-				ms.ClearConfigError()
-				if ms.onConfigUpdated != nil {
-					ms.onConfigUpdated()
-				}
-				ms.updateBrowserMenuItems()
+				ms.configSaved(err)
+				ms.UpdateLearnedMenuItems()
+			}
+		}(removeItem, rule.Domain)
+	}
+}
+
+// UpdateSubscriptionMenuItems lists the subscribed rule packs with when each was last synced,
+// and a "Sync Now" entry. The menu item is hidden when there are no subscriptions.
+func (ms *MenuService) UpdateSubscriptionMenuItems() {
+	ms.subscriptionLock.Lock()
+	defer ms.subscriptionLock.Unlock()
+	if ms.mSubscriptions == nil {
+		return
+	}
+	for _, menuItem := range ms.subscriptionMenuItems {
+		menuItem.Hide()
+	}
+	ms.subscriptionMenuItems = nil
+
+	subscriptions := ms.configService.Subscriptions()
+	if len(subscriptions) == 0 {
+		ms.mSubscriptions.Hide()
+		return
+	}
+	ms.mSubscriptions.SetTitle("Rule Packs")
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		text := strings.TrimPrefix(subscription.URL, "https://")
+		tooltip := subscription.URL
+		if subscription.Err != "" {
+			ms.mSubscriptions.SetTitle("Rule Packs (sync failed)")
+			tooltip = "Sync failed: " + subscription.Err
+		}
+		item := ms.mSubscriptions.AddSubMenuItem(truncateMenuText(text, 50)+" — "+syncStatusText(subscription, now), tooltip)
+		item.Disable()
+		ms.subscriptionMenuItems = append(ms.subscriptionMenuItems, item)
+	}
+	syncItem := ms.mSubscriptions.AddSubMenuItem("Sync Now", "Check every rule pack for a new version")
+	ms.subscriptionMenuItems = append(ms.subscriptionMenuItems, syncItem)
+	go func(item *systray.MenuItem) {
+		for range item.ClickedCh {
+			changed, err := ms.configService.SyncSubscriptions(true)
+			if err != nil {
+				log.Printf("Cannot sync rule packs: %v", err)
+			}
+			if changed && ms.onConfigUpdated != nil {
+				ms.onConfigUpdated()
+			}
+			ms.UpdateSubscriptionMenuItems()
+		}
+	}(syncItem)
+}
+
+// syncStatusText describes when a rule pack was last synced, e.g. "synced 14:05"
+func syncStatusText(subscription SubscriptionStatus, now time.Time) string {
+	synced := subscription.SyncedAt.Local()
+	text := synced.Format("Jan 2 15:04")
+	if year, month, day := synced.Date(); now.Year() == year && now.Month() == month && now.Day() == day {
+		text = synced.Format("15:04")
+	}
+	switch {
+	case subscription.Err != "" && subscription.Cached && !synced.IsZero():
+		return "sync failed, using copy from " + text
+	case subscription.Err != "":
+		return "sync failed"
+	case synced.IsZero():
+		return "not synced yet"
+	}
+	return "synced " + text
+}
+
+// handlePendingChoice makes a menu item open a pending link in a browser
+func (ms *MenuService) handlePendingChoice(item *systray.MenuItem, id int, browserPath string, profile string) {
+	go func() {
+		for range item.ClickedCh {
+			if err := ms.chooser.Choose(id, browserPath, profile); err != nil {
+				log.Printf("Cannot open pending link: %v", err)
 			}
-		}(menuItem, browser.Path)
+		}
+	}()
+}
+
+// NotifyPendingLink tells the user that a link is waiting for a browser choice
+func (ms *MenuService) NotifyPendingLink(link PendingLink) {
+	script := fmt.Sprintf(`display notification "%s\n\nChoose a browser under Pending link in the menu bar." with title "Browser Redirect Bar"`,
+		appleScriptEscape(link.Decision.OpenURL))
+	_ = exec.Command("osascript", "-e", script).Run()
+}
+
+// truncateMenuText shortens text to at most limit runes for a menu title
+func truncateMenuText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
 	}
+	return string(runes[:limit-1]) + "…"
 }
 
 // checkConfigErrors checks if there are config errors and updates the menu
@@ -148,44 +418,56 @@ func (ms *MenuService) checkConfigErrors() {
 	if err != nil {
 		ms.configError = err.Error()
 		if ms.mConfigError != nil {
+			ms.mConfigError.SetTooltip(ms.configError)
 			ms.mConfigError.Show()
 		}
 		// Show notification
 		ms.showConfigErrorNotification()
 	} else {
-		ms.configError = ""
-		if ms.mConfigError != nil {
-			ms.mConfigError.Hide()
-		}
+		ms.ClearConfigError()
 	}
 }
 
 // showConfigErrorNotification shows a macOS notification about the config error
 func (ms *MenuService) showConfigErrorNotification() {
-	errorMsg := "Invalid JSON in config file"
+	errorMsg := "Invalid config file"
 	if ms.configError != "" {
 		errorMsg = ms.configError
 	}
 
 	// Use osascript to show a macOS notification
-	script := fmt.Sprintf(`display notification "%s\n\nPlease fix the JSON syntax in:\n%s" with title "Browser Redirect Bar - Config Error"`,
-		errorMsg, ms.configPath)
+	script := fmt.Sprintf(`display notification "%s\n\nPlease fix the config file:\n%s" with title "Browser Redirect Bar - Config Error"`,
+		appleScriptEscape(errorMsg), appleScriptEscape(ms.configPath))
 	_ = exec.Command("osascript", "-e", script).Run()
 }
 
-// ShowConfigError displays a config error in the menu and shows a notification
+// appleScriptEscape escapes backslashes and quotes so text can be embedded in an AppleScript string
+func appleScriptEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// ShowConfigError displays a config error in the menu and shows a notification.
+// The full list of problems is shown as the tooltip of the menu item.
 func (ms *MenuService) ShowConfigError(errorMsg string) {
 	ms.configError = errorMsg
 	if ms.mConfigError != nil {
+		ms.mConfigError.SetTooltip(errorMsg)
 		ms.mConfigError.Show()
 	}
 	ms.showConfigErrorNotification()
 }
 
-// ClearConfigError clears the config error from the menu
+// ClearConfigError clears the config error from the menu. Ignored config files next to the one
+// in use are still shown there, without a notification.
 func (ms *MenuService) ClearConfigError() {
-	ms.configError = ""
-	if ms.mConfigError != nil {
+	ms.configError = ms.configService.ConfigFileConflict()
+	if ms.mConfigError == nil {
+		return
+	}
+	if ms.configError != "" {
+		ms.mConfigError.SetTooltip(ms.configError)
+		ms.mConfigError.Show()
+	} else {
 		ms.mConfigError.Hide()
 	}
 }
@@ -201,6 +483,8 @@ func (ms *MenuService) reloadConfig() {
 		ms.onConfigUpdated()
 	}
 	ms.updateBrowserMenuItems()
+	ms.UpdateLearnedMenuItems()
+	ms.UpdateSubscriptionMenuItems()
 	_ = exec.Command("osascript", "-e", `display notification "Configuration reloaded" with title "Browser Redirect Bar"`).Run()
 }
 
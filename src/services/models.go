@@ -2,13 +2,150 @@ package services
 
 // BrowserConfig represents a browser configuration with URL patterns
 type BrowserConfig struct {
-	Patterns      []string `json:"patterns"`      // Simple string matching (case-insensitive)
-	RegexPatterns []string `json:"regexPatterns"` // Regex pattern matching
-	BrowserURL    string   `json:"browserURL"`    // Path to browser application (e.g., "/Applications/Google Chrome.app")
+	Patterns      []string      `json:"patterns"`           // Simple string matching (case-insensitive)
+	RegexPatterns []string      `json:"regexPatterns"`      // Regex pattern matching
+	Matchers      []URLMatcher  `json:"matchers,omitempty"` // Structured matching against the parsed URL
+	BrowserURL    string        `json:"browserURL"`         // Path to browser application (e.g., "/Applications/Google Chrome.app")
+	Profile       string        `json:"profile,omitempty"`  // Browser profile, e.g. "Profile 1" for Chromium browsers or "work" for Firefox
+	Launch        *LaunchConfig `json:"launch,omitempty"`   // How the browser opens the URL, e.g. in a private window
+	Priority      int           `json:"priority,omitempty"` // Higher priority rules win over lower ones (default 0)
+	Ask           bool          `json:"ask,omitempty"`      // Ask which browser to use; browserURL opens the URL if no choice is made in time
+	Learned       bool          `json:"learned,omitempty"`  // Added by remembering a browser choice, see ConfigService.AddLearnedRule
+
+	// Several browsers for one rule: "first" (default) opens the URL in the first one listed,
+	// "all" opens it in browserURL and every entry of browserURLs at the same time
+	BrowserURLs []string `json:"browserURLs,omitempty"`
+	Open        string   `json:"open,omitempty"`
+
+	KeepTrackingParams bool `json:"keepTrackingParams,omitempty"` // Open the URL with its tracking parameters intact
+
+	// Excludes skip the rule when any of them match, even if a pattern above matched
+	ExcludePatterns      []string     `json:"excludePatterns,omitempty"`
+	ExcludeRegexPatterns []string     `json:"excludeRegexPatterns,omitempty"`
+	ExcludeMatchers      []URLMatcher `json:"excludeMatchers,omitempty"`
+
+	// Conditions must all hold for the rule to apply. A rule with conditions but no
+	// patterns, regexes or matchers applies to every URL that satisfies them.
+	SourceApps []string          `json:"sourceApps,omitempty"` // Bundle identifiers of apps the link must come from
+	Schedule   *Schedule         `json:"schedule,omitempty"`   // Weekdays and times of day the rule is active
+	Network    *NetworkCondition `json:"network,omitempty"`    // Local network state, e.g. VPN connected
+}
+
+// LaunchConfig selects how a browser opens a URL. Options a browser can't honor are skipped and logged.
+type LaunchConfig struct {
+	Private    bool `json:"private,omitempty"`    // Private (incognito) window
+	NewWindow  bool `json:"newWindow,omitempty"`  // New window instead of a tab
+	Background bool `json:"background,omitempty"` // Don't bring the browser to the front
+	App        bool `json:"app,omitempty"`        // Standalone app window without browser UI (Chromium browsers only)
+}
+
+// URLMatcher matches the parts of a parsed URL. Every non-empty field must match.
+type URLMatcher struct {
+	Scheme string            `json:"scheme,omitempty"` // e.g. "https" (case-insensitive)
+	Host   string            `json:"host,omitempty"`   // Exact host, or "*.example.com" for any subdomain
+	Domain string            `json:"domain,omitempty"` // Registrable domain, e.g. "github.com" matches gist.github.com
+	Port   string            `json:"port,omitempty"`   // Port ("8080") or inclusive range ("8000-8999")
+	Path   string            `json:"path,omitempty"`   // Path prefix, or a glob when it contains *, ? or [
+	Query  map[string]string `json:"query,omitempty"`  // Required query parameters; an empty value only requires presence
+}
+
+// Schedule restricts a rule to certain weekdays and times of day
+type Schedule struct {
+	Weekdays []string     `json:"weekdays,omitempty"` // Day names or ranges, e.g. ["mon-fri"]; empty means every day
+	Hours    []TimeWindow `json:"hours,omitempty"`    // Active time windows; empty means all day
+	TimeZone string       `json:"timeZone,omitempty"` // IANA time zone, e.g. "Europe/Amsterdam"; empty means local time
+}
+
+// TimeWindow is a daily time range in "HH:MM" format. The end is exclusive, and a
+// window whose end is before its start wraps past midnight (e.g. "22:00"-"06:00").
+type TimeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// NetworkCondition restricts a rule to a local network state.
+// Each non-empty list needs at least one match; all non-empty lists must match.
+type NetworkCondition struct {
+	Interfaces    []string `json:"interfaces,omitempty"`    // An interface with one of these names is up; "utun*" matches by prefix
+	CIDRs         []string `json:"cidrs,omitempty"`         // A local address lies in one of these ranges, e.g. "10.8.0.0/16"
+	SearchDomains []string `json:"searchDomains,omitempty"` // One of these DNS search domains is configured
+}
+
+// URLRequest is a URL to open together with the app that opened it
+type URLRequest struct {
+	URL       string
+	SourceApp string // Bundle identifier of the sending app (e.g. "com.tinyspeck.slackmacgap"), empty if unknown
+	SourcePID int    // Process ID of the sending app, 0 if unknown
 }
 
 // Config represents the application configuration
 type Config struct {
-	Browsers          []BrowserConfig `json:"browsers"`
-	DefaultBrowserURL string          `json:"defaultBrowserURL"` // Path to default browser application
+	Browsers              []BrowserConfig   `json:"browsers"`
+	DefaultBrowserURL     string            `json:"defaultBrowserURL"`               // Path to default browser application
+	DefaultBrowserProfile string            `json:"defaultBrowserProfile,omitempty"` // Profile of the default browser to open URLs in
+	DefaultLaunch         *LaunchConfig     `json:"defaultLaunch,omitempty"`         // How the default browser opens URLs
+	AskUnmatched          bool              `json:"askUnmatched,omitempty"`          // Ask which browser to use for web URLs no rule matches
+	AskTimeout            string            `json:"askTimeout,omitempty"`            // How long to wait for a choice, e.g. "30s" (default "60s")
+	DefaultApps           map[string]string `json:"defaultApps,omitempty"`           // Application per URL scheme when no rule matches, e.g. {"mailto": "/System/Applications/Mail.app"}
+	MatchMode             string            `json:"matchMode,omitempty"`             // How to pick between matching rules: "first" (default) or "specific"
+	Wrappers              []WrapperRule     `json:"wrappers,omitempty"`              // Extra redirectors to unwrap before matching
+	Rewrites              []RewriteRule     `json:"rewrites,omitempty"`              // URL rewrites applied before matching and opening
+
+	Shorteners *ShortenerConfig `json:"shorteners,omitempty"` // Short link hosts to expand before matching
+
+	TrackingParams *TrackingParamsConfig `json:"trackingParams,omitempty"` // Removal of tracking query parameters
+
+	Include       []string       `json:"include,omitempty"`       // Further config files merged into this one, relative to this file
+	Subscriptions []Subscription `json:"subscriptions,omitempty"` // Rule packs downloaded from the web and merged after every local file
+
+	LogLevel string `json:"logLevel,omitempty"` // "info" (default) or "debug" to log why each URL went to its browser
+}
+
+// Subscription is a rule pack served over HTTPS. It is kept up to date in the background,
+// cached for offline use, and merged like an included file.
+type Subscription struct {
+	URL            string `json:"url"`                      // HTTPS URL of the rule pack, in the config file format
+	RefreshMinutes int    `json:"refreshMinutes,omitempty"` // How often to check for a new version (default 360)
+	SHA256         string `json:"sha256,omitempty"`         // Expected SHA-256 of the pack in hex, pinning one exact version
+	PublicKey      string `json:"publicKey,omitempty"`      // Base64 Ed25519 public key the pack must be signed with
+	SignatureURL   string `json:"signatureURL,omitempty"`   // Where the base64 signature is served (default: url + ".sig")
+}
+
+// TrackingParamsConfig configures which query parameters are removed before a URL is matched and opened.
+// Parameter names are case-insensitive, and a trailing * matches by prefix (e.g. "utm_*").
+type TrackingParamsConfig struct {
+	Disabled bool                  `json:"disabled,omitempty"` // Turn scrubbing off entirely
+	Remove   []string              `json:"remove,omitempty"`   // Parameters removed in addition to the built-in list
+	Keep     []string              `json:"keep,omitempty"`     // Parameters never removed, even if in the built-in list
+	Domains  []DomainParamOverride `json:"domains,omitempty"`  // Overrides for specific sites
+}
+
+// DomainParamOverride changes which parameters are removed for a domain and its subdomains
+type DomainParamOverride struct {
+	Domain string   `json:"domain"`
+	Remove []string `json:"remove,omitempty"`
+	Keep   []string `json:"keep,omitempty"`
+}
+
+// WrapperRule describes a redirector whose destination is held in a query parameter
+type WrapperRule struct {
+	Host  string `json:"host"`           // Host of the redirector, or "*.example.com" for its subdomains
+	Path  string `json:"path,omitempty"` // Optional path prefix of the redirector
+	Param string `json:"param"`          // Query parameter holding the destination URL
+}
+
+// ShortenerConfig configures expanding short links by following their HTTP redirects
+type ShortenerConfig struct {
+	Hosts        []string `json:"hosts"`                  // Shortener hosts, e.g. "bit.ly", "t.co" or "go.corp.example.com"
+	TimeoutMs    int      `json:"timeoutMs,omitempty"`    // Time allowed for expanding one link (default 2000)
+	MaxHops      int      `json:"maxHops,omitempty"`      // Redirects followed at most (default 5)
+	CacheMinutes int      `json:"cacheMinutes,omitempty"` // How long expanded links are remembered (default 60)
+}
+
+// RewriteRule transforms a URL before it is matched and opened.
+// When Template is set it renders the whole new URL; otherwise find is replaced with Replace.
+type RewriteRule struct {
+	Find     string `json:"find"`               // Regular expression matched against the URL
+	Replace  string `json:"replace,omitempty"`  // Replacement, may reference capture groups as $1 or ${name}
+	Template string `json:"template,omitempty"` // Go text/template rendering the new URL, e.g. "https://jira.example.com/browse/{{index .Groups 1}}"
 }
@@ -2,6 +2,6 @@
 
 // C bridge function that Objective-C can call
 // This calls the Go-exported function
-void bridgeSendURLToGo(const char* url) {
-    sendURLToGo((char*)url);
+void bridgeSendURLToGo(const char* url, const char* sourceBundleID, int sourcePID) {
+    sendURLToGo((char*)url, (char*)sourceBundleID, sourcePID);
 }
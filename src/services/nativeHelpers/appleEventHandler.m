@@ -3,7 +3,21 @@
 #import <Carbon/Carbon.h>
 
 // Forward declaration of the bridge function
-extern void bridgeSendURLToGo(const char* url);
+extern void bridgeSendURLToGo(const char* url, const char* sourceBundleID, int sourcePID);
+
+// senderPID returns the process ID of the app that sent the Apple Event, or 0 if unknown
+static pid_t senderPID(NSAppleEventDescriptor *event) {
+    NSAppleEventDescriptor *pidDescriptor = [event attributeDescriptorForKeyword:keySenderPIDAttr];
+    if (!pidDescriptor) return 0;
+    return (pid_t)[pidDescriptor int32Value];
+}
+
+// senderBundleID returns the bundle identifier of the running app with the given PID, or nil
+static NSString *senderBundleID(pid_t pid) {
+    if (pid <= 0) return nil;
+    NSRunningApplication *app = [NSRunningApplication runningApplicationWithProcessIdentifier:pid];
+    return app ? [app bundleIdentifier] : nil;
+}
 
 // Dedicated handler for GetURL Apple Events (not the app delegate)
 @interface GetURLHandler : NSObject
@@ -18,7 +32,9 @@ extern void bridgeSendURLToGo(const char* url);
         if (urlString) {
             const char *urlCStr = [urlString UTF8String];
             if (urlCStr) {
-                bridgeSendURLToGo(urlCStr);
+                pid_t pid = senderPID(event);
+                NSString *bundleID = senderBundleID(pid);
+                bridgeSendURLToGo(urlCStr, bundleID ? [bundleID UTF8String] : NULL, (int)pid);
             }
         }
     }
@@ -28,6 +44,9 @@ extern void bridgeSendURLToGo(const char* url);
     NSAppleEventDescriptor *directObject = [event paramDescriptorForKeyword:keyDirectObject];
     if (!directObject) return;
 
+    pid_t pid = senderPID(event);
+    NSString *bundleID = senderBundleID(pid);
+
     NSInteger count = [directObject numberOfItems];
     for (NSInteger i = 1; i <= count; i++) {
         NSAppleEventDescriptor *item = [directObject descriptorAtIndex:i];
@@ -40,7 +59,7 @@ extern void bridgeSendURLToGo(const char* url);
         if (fileURL) {
             const char *urlCStr = [[fileURL absoluteString] UTF8String];
             if (urlCStr) {
-                bridgeSendURLToGo(urlCStr);
+                bridgeSendURLToGo(urlCStr, bundleID ? [bundleID UTF8String] : NULL, (int)pid);
             }
         }
     }
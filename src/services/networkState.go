@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// networkStateCacheTTL is how long a network snapshot is reused before it is read again
+const networkStateCacheTTL = 5 * time.Second
+
+// NetworkInterface describes a local network interface
+type NetworkInterface struct {
+	Name  string
+	Up    bool
+	Addrs []net.IP
+}
+
+// NetworkState is a snapshot of the local network configuration
+type NetworkState struct {
+	Interfaces    []NetworkInterface
+	SearchDomains []string // DNS resolver search domains
+}
+
+// NetworkStateProvider takes snapshots of the local network state
+type NetworkStateProvider interface {
+	Snapshot() (NetworkState, error)
+}
+
+// SystemNetworkState is the production NetworkStateProvider that reads the live system state
+type SystemNetworkState struct{}
+
+// NewSystemNetworkState creates a new SystemNetworkState
+func NewSystemNetworkState() *SystemNetworkState {
+	return &SystemNetworkState{}
+}
+
+// Snapshot reads the interfaces and resolver search domains of this machine
+func (s *SystemNetworkState) Snapshot() (NetworkState, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return NetworkState{}, err
+	}
+	var state NetworkState
+	for _, iface := range ifaces {
+		info := NetworkInterface{
+			Name: iface.Name,
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		addrs, err := iface.Addrs()
+		if err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					info.Addrs = append(info.Addrs, ipNet.IP)
+				}
+			}
+		}
+		state.Interfaces = append(state.Interfaces, info)
+	}
+	state.SearchDomains = systemSearchDomains()
+	return state, nil
+}
+
+// systemSearchDomains reads resolver search domains from scutil (macOS), falling back to /etc/resolv.conf
+func systemSearchDomains() []string {
+	if output, err := exec.Command("scutil", "--dns").Output(); err == nil {
+		if domains := ParseScutilSearchDomains(string(output)); len(domains) > 0 {
+			return domains
+		}
+	}
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	return ParseResolvConfSearchDomains(string(data))
+}
+
+// ParseScutilSearchDomains extracts the "search domain[n] : example.com" entries of `scutil --dns`
+func ParseScutilSearchDomains(output string) []string {
+	var domains []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "search domain[") {
+			continue
+		}
+		if _, domain, ok := strings.Cut(line, ":"); ok {
+			domains = appendUnique(domains, normalizeHost(strings.TrimSpace(domain)))
+		}
+	}
+	return domains
+}
+
+// ParseResolvConfSearchDomains extracts the "search" and "domain" entries of resolv.conf
+func ParseResolvConfSearchDomains(data string) []string {
+	var domains []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || (fields[0] != "search" && fields[0] != "domain") {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			domains = appendUnique(domains, normalizeHost(domain))
+		}
+	}
+	return domains
+}
+
+// appendUnique appends value unless it is empty or already present
+func appendUnique(values []string, value string) []string {
+	if value == "" || slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// cachedNetworkState reuses a snapshot of another provider for a short time
+type cachedNetworkState struct {
+	provider NetworkStateProvider
+	ttl      time.Duration
+	clock    Clock
+	mu       sync.Mutex
+	state    NetworkState
+	err      error
+	fetched  time.Time
+	valid    bool
+}
+
+// NewCachedNetworkState wraps a provider so snapshots are reused for ttl
+func NewCachedNetworkState(provider NetworkStateProvider, ttl time.Duration) NetworkStateProvider {
+	return NewCachedNetworkStateWithClock(provider, ttl, realClock{})
+}
+
+// NewCachedNetworkStateWithClock wraps a provider using the given clock to expire snapshots (for testing)
+func NewCachedNetworkStateWithClock(provider NetworkStateProvider, ttl time.Duration, clock Clock) NetworkStateProvider {
+	return &cachedNetworkState{
+		provider: provider,
+		ttl:      ttl,
+		clock:    clock,
+	}
+}
+
+// Snapshot returns the cached snapshot, reading a new one when it has expired
+func (c *cachedNetworkState) Snapshot() (NetworkState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if c.valid && now.Sub(c.fetched) < c.ttl {
+		return c.state, c.err
+	}
+	c.state, c.err = c.provider.Snapshot()
+	c.fetched = now
+	c.valid = true
+	return c.state, c.err
+}
+
+// compiledNetwork is a NetworkCondition with its CIDR ranges parsed
+type compiledNetwork struct {
+	interfaces    []string
+	networks      []*net.IPNet
+	searchDomains []string
+}
+
+// compileNetwork validates a NetworkCondition and prepares it for evaluation
+func compileNetwork(condition *NetworkCondition) (*compiledNetwork, error) {
+	c := &compiledNetwork{
+		interfaces: condition.Interfaces,
+	}
+	for _, cidr := range condition.CIDRs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		c.networks = append(c.networks, network)
+	}
+	for _, domain := range condition.SearchDomains {
+		c.searchDomains = append(c.searchDomains, normalizeHost(domain))
+	}
+	return c, nil
+}
+
+// met reports whether every non-empty list of the condition has a match in the state
+func (c *compiledNetwork) met(state NetworkState) bool {
+	if len(c.interfaces) > 0 && !anyInterfaceUp(c.interfaces, state) {
+		return false
+	}
+	if len(c.networks) > 0 && !anyAddressInNetworks(c.networks, state) {
+		return false
+	}
+	if len(c.searchDomains) > 0 && !anySearchDomain(c.searchDomains, state) {
+		return false
+	}
+	return true
+}
+
+// anyInterfaceUp reports whether an interface with one of the names is up; "utun*" matches by prefix
+func anyInterfaceUp(names []string, state NetworkState) bool {
+	for _, iface := range state.Interfaces {
+		if !iface.Up {
+			continue
+		}
+		for _, name := range names {
+			if prefix, ok := strings.CutSuffix(name, "*"); ok && strings.HasPrefix(iface.Name, prefix) {
+				return true
+			}
+			if iface.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anyAddressInNetworks reports whether an address of an interface that is up lies inside one of the ranges
+func anyAddressInNetworks(networks []*net.IPNet, state NetworkState) bool {
+	for _, iface := range state.Interfaces {
+		if !iface.Up {
+			continue
+		}
+		for _, addr := range iface.Addrs {
+			for _, network := range networks {
+				if network.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anySearchDomain reports whether one of the normalized domains is a configured resolver search domain
+func anySearchDomain(domains []string, state NetworkState) bool {
+	for _, searchDomain := range state.SearchDomains {
+		if slices.Contains(domains, normalizeHost(searchDomain)) {
+			return true
+		}
+	}
+	return false
+}
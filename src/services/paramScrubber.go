@@ -0,0 +1,146 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// defaultTrackingParams are removed from every URL unless kept by config; a trailing * matches by prefix
+var defaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"mc_eid",
+	"mc_cid",
+	"_hsenc",
+	"_hsmi",
+	"__hssc",
+	"__hstc",
+	"__hsfp",
+	"hsCtaTracking",
+	"igshid",
+	"yclid",
+	"twclid",
+	"ttclid",
+	"li_fat_id",
+	"mkt_tok",
+	"oly_anon_id",
+	"oly_enc_id",
+	"vero_id",
+	"vero_conv",
+	"_openstat",
+	"wickedid",
+	"rb_clickid",
+	"s_cid",
+}
+
+// ParamScrubber removes tracking query parameters from URLs
+type ParamScrubber struct {
+	config TrackingParamsConfig
+	lock   sync.RWMutex
+}
+
+// NewParamScrubber creates a new ParamScrubber; a nil config uses the built-in defaults
+func NewParamScrubber(config *TrackingParamsConfig) *ParamScrubber {
+	ps := &ParamScrubber{}
+	ps.UpdateConfig(config)
+	return ps
+}
+
+// UpdateConfig replaces the scrubbing configuration; a nil config uses the built-in defaults
+func (ps *ParamScrubber) UpdateConfig(config *TrackingParamsConfig) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if config == nil {
+		ps.config = TrackingParamsConfig{}
+		return
+	}
+	ps.config = *config
+}
+
+// Scrub returns the URL without tracking parameters, and the names of the removed parameters.
+// The order and encoding of the remaining parameters are preserved.
+func (ps *ParamScrubber) Scrub(rawURL string) (string, []string) {
+	ps.lock.RLock()
+	config := ps.config
+	ps.lock.RUnlock()
+
+	if config.Disabled {
+		return rawURL, nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.RawQuery == "" {
+		return rawURL, nil
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return rawURL, nil
+	}
+
+	host := normalizeHost(parsed.Hostname())
+	var kept, removed []string
+	for _, part := range strings.Split(parsed.RawQuery, "&") {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if part != "" && shouldRemoveParam(config, host, key) {
+			removed = append(removed, key)
+			continue
+		}
+		kept = append(kept, part)
+	}
+	if len(removed) == 0 {
+		return rawURL, nil
+	}
+	parsed.RawQuery = strings.Join(kept, "&")
+	return parsed.String(), removed
+}
+
+// shouldRemoveParam decides whether a parameter is removed for a host.
+// Precedence: domain keep, domain remove, global keep, then global remove and the defaults.
+func shouldRemoveParam(config TrackingParamsConfig, host, name string) bool {
+	for _, override := range config.Domains {
+		if !overrideAppliesTo(override.Domain, host) {
+			continue
+		}
+		if paramListMatches(override.Keep, name) {
+			return false
+		}
+		if paramListMatches(override.Remove, name) {
+			return true
+		}
+	}
+	if paramListMatches(config.Keep, name) {
+		return false
+	}
+	return paramListMatches(config.Remove, name) || paramListMatches(defaultTrackingParams, name)
+}
+
+// overrideAppliesTo reports whether a domain override covers the host or one of its parent domains
+func overrideAppliesTo(domain, host string) bool {
+	domain = strings.TrimPrefix(normalizeHost(domain), "*.")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// paramListMatches reports whether name is in the list; entries ending in * match by prefix (case-insensitive)
+func paramListMatches(list []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, entry := range list {
+		entry = strings.ToLower(entry)
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
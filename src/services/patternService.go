@@ -1,73 +1,255 @@
 package services
 
 import (
-	"regexp"
+	"log"
 	"strings"
 	"sync"
 )
 
 // PatternService handles URL pattern matching
 type PatternService struct {
-	config         Config
-	regexCache     map[string]*regexp.Regexp
-	regexCacheLock sync.RWMutex
+	rules         *CompiledRules
+	rulesLock     sync.RWMutex
+	clock         Clock
+	networkState  NetworkStateProvider
+	urlPipeline   *URLPipeline
+	paramScrubber *ParamScrubber
 }
 
-// NewPatternService creates a new PatternService instance
+// NewPatternService creates a new PatternService instance.
+// Invalid rules are logged and left out; use CompileRules to reject them instead.
 func NewPatternService(config Config) *PatternService {
+	rules, err := CompileRules(config)
+	if err != nil {
+		log.Printf("Ignoring invalid rules: %v", err)
+	}
+	return NewPatternServiceWithRules(rules)
+}
+
+// NewPatternServiceWithRules creates a new PatternService from already compiled rules
+func NewPatternServiceWithRules(rules *CompiledRules) *PatternService {
 	return &PatternService{
-		config:     config,
-		regexCache: make(map[string]*regexp.Regexp),
+		rules:        rules,
+		clock:        realClock{},
+		networkState: NewCachedNetworkState(NewSystemNetworkState(), networkStateCacheTTL),
 	}
 }
 
-// UpdateConfig updates the configuration used for pattern matching
+// SetClock replaces the clock used to evaluate schedule conditions (for testing)
+func (ps *PatternService) SetClock(clock Clock) {
+	ps.clock = clock
+}
+
+// SetNetworkState replaces the provider used to evaluate network conditions (for testing)
+func (ps *PatternService) SetNetworkState(provider NetworkStateProvider) {
+	ps.networkState = provider
+}
+
+// SetURLPipeline sets the stages (unwrapping, short links, rewrites) a URL passes through before matching
+func (ps *PatternService) SetURLPipeline(pipeline *URLPipeline) {
+	ps.urlPipeline = pipeline
+}
+
+// SetParamScrubber sets the scrubber that removes tracking parameters before matching
+func (ps *PatternService) SetParamScrubber(scrubber *ParamScrubber) {
+	ps.paramScrubber = scrubber
+}
+
+// UpdateConfig compiles the configuration and uses it for pattern matching; invalid rules are logged and left out
 func (ps *PatternService) UpdateConfig(config Config) {
-	ps.config = config
+	rules, err := CompileRules(config)
+	if err != nil {
+		log.Printf("Ignoring invalid rules: %v", err)
+	}
+	ps.UpdateRules(rules)
+}
+
+// UpdateRules replaces the compiled rules used for pattern matching
+func (ps *PatternService) UpdateRules(rules *CompiledRules) {
+	ps.rulesLock.Lock()
+	ps.rules = rules
+	ps.rulesLock.Unlock()
 }
 
 // FindBrowserForURL finds the appropriate browser for a given URL based on patterns
-func (ps *PatternService) FindBrowserForURL(url string) string {
-	urlLower := strings.ToLower(url)
-
-	for _, browserConfig := range ps.config.Browsers {
-		for _, pattern := range browserConfig.Patterns {
-			if strings.Contains(urlLower, strings.ToLower(pattern)) {
-				return browserConfig.BrowserURL
-			}
+func (ps *PatternService) FindBrowserForURL(rawURL string) string {
+	return ps.FindBrowserForRequest(URLRequest{URL: rawURL})
+}
+
+// FindBrowserForRequest finds the appropriate browser for a URL request based on patterns and conditions
+func (ps *PatternService) FindBrowserForRequest(request URLRequest) string {
+	rule, ok := ps.FindRuleForRequest(request)
+	if !ok {
+		return ""
+	}
+	if browsers := ruleBrowsers(rule); len(browsers) > 0 {
+		return browsers[0]
+	}
+	return ""
+}
+
+// FindRuleForRequest returns the browser rule that matches a URL request, if any.
+// When several rules match, the one with the highest priority wins; see isBetterMatch
+// for how the match mode and config order break ties.
+func (ps *PatternService) FindRuleForRequest(request URLRequest) (BrowserConfig, bool) {
+	rules := ps.currentRules()
+	index := ps.findRule(rules, request, canonicalize(request.URL))
+	if index == -1 {
+		return BrowserConfig{}, false
+	}
+	return rules.rules[index].config, true
+}
+
+// Resolve runs the URL through the pipeline and the tracking parameter scrubber, finds the
+// matching rule and falls back to the default application for the scheme and, for web URLs,
+// to the default browser, then Safari. Decision.Rules stays empty.
+func (ps *PatternService) Resolve(request URLRequest) Decision {
+	return ps.decide(request, false)
+}
+
+// Explain is like Resolve, but evaluates every rule and records each pattern, matcher and
+// condition it checked, to find out why a URL went to a browser
+func (ps *PatternService) Explain(request URLRequest) Decision {
+	return ps.decide(request, true)
+}
+
+// decide implements Resolve and Explain
+func (ps *PatternService) decide(request URLRequest, explain bool) Decision {
+	rules := ps.currentRules()
+	decision := Decision{Request: request, MatchMode: rules.config.MatchMode, RuleIndex: -1}
+
+	processedURL := request.URL
+	if ps.urlPipeline != nil {
+		processedURL, decision.Stages = ps.urlPipeline.Process(request.URL)
+	}
+	cleanURL := processedURL
+	if ps.paramScrubber != nil {
+		cleanURL, decision.RemovedParams = ps.paramScrubber.Scrub(processedURL)
+	}
+	target := canonicalize(cleanURL)
+	decision.MatchURL, decision.OpenURL = target.raw, cleanURL
+
+	matchRequest := request
+	matchRequest.URL = cleanURL
+	if explain {
+		decision.RuleIndex, decision.Rules = ps.explainRules(rules, matchRequest, target)
+	} else {
+		decision.RuleIndex = ps.findRule(rules, matchRequest, target)
+	}
+	if decision.RuleIndex >= 0 {
+		compiled := &rules.rules[decision.RuleIndex]
+		rule := compiled.config
+		if len(compiled.browsers) > 0 {
+			decision.BrowserURL = compiled.browsers[0]
 		}
-		for _, regexPattern := range browserConfig.RegexPatterns {
-			compiled, err := ps.getCompiledRegex(regexPattern)
-			if err != nil {
-				continue
-			}
-			if compiled.MatchString(url) {
-				return browserConfig.BrowserURL
-			}
+		if rule.Open == OpenAll && len(compiled.browsers) > 1 {
+			decision.BrowserURLs = compiled.browsers
+		}
+		decision.Launch = NewLaunchOptions(rule.Profile, rule.Launch)
+		decision.Ask = rule.Ask
+		if rule.KeepTrackingParams {
+			decision.OpenURL = processedURL
 		}
 	}
-	return ""
+	if target.parsed != nil {
+		decision.Scheme = strings.ToLower(target.parsed.Scheme)
+	}
+	// A rule that matched without naming a browser still decides, so only unmatched URLs report a fallback
+	fallback := func(reason string) string {
+		if decision.RuleIndex >= 0 {
+			return FallbackNone
+		}
+		return reason
+	}
+	if decision.BrowserURL == "" {
+		decision.BrowserURL, decision.Fallback = rules.defaultApps[decision.Scheme], fallback(FallbackDefaultApp)
+	}
+	if decision.BrowserURL == "" && !webSchemes[decision.Scheme] {
+		// Handing the URL back to the system could send it straight back to brb
+		decision.Fallback = FallbackUnhandled
+		return decision
+	}
+	if decision.RuleIndex < 0 && rules.config.AskUnmatched && webSchemes[decision.Scheme] {
+		decision.Ask = true
+	}
+	if decision.BrowserURL == "" {
+		decision.BrowserURL, decision.Fallback = rules.config.DefaultBrowserURL, fallback(FallbackDefault)
+		decision.Launch = NewLaunchOptions(rules.config.DefaultBrowserProfile, rules.config.DefaultLaunch)
+	}
+	if decision.BrowserURL == "" {
+		decision.BrowserURL, decision.Fallback = safariFallbackURL, fallback(FallbackSafari)
+	}
+	return decision
+}
+
+// currentRules returns the compiled rules in use
+func (ps *PatternService) currentRules() *CompiledRules {
+	ps.rulesLock.RLock()
+	defer ps.rulesLock.RUnlock()
+	return ps.rules
 }
 
-// getCompiledRegex returns a compiled regex, using cache for performance
-func (ps *PatternService) getCompiledRegex(pattern string) (*regexp.Regexp, error) {
-	ps.regexCacheLock.RLock()
-	if cached, exists := ps.regexCache[pattern]; exists {
-		ps.regexCacheLock.RUnlock()
-		return cached, nil
+// findRule returns the index of the rule that matches the request, or -1.
+// Rules are matched against the canonical form of the request URL in target.
+func (ps *PatternService) findRule(rules *CompiledRules, request URLRequest, target canonicalURL) int {
+	mode := rules.config.MatchMode
+	exhaustive := mode == MatchModeSpecific
+
+	eval := ps.newEvaluation(request)
+	bestIndex := -1
+	var bestSpec specificity
+	for _, candidate := range rules.index.candidates(target) {
+		rule := &rules.rules[candidate.rule]
+		if !conditionsMet(rule, eval) {
+			continue
+		}
+		matched, spec := candidate.verify(rule, target, exhaustive)
+		if !matched && (rule.hasURLCriteria || !rule.hasConditions) {
+			continue
+		}
+		if excluded, _ := criteriaMatch(rule.exclude, target, false); excluded {
+			continue
+		}
+		spec.conditions += rule.conditions
+		if bestIndex == -1 || isBetterMatch(mode, rule.config, spec, rules.rules[bestIndex].config, bestSpec) {
+			bestIndex, bestSpec = candidate.rule, spec
+		}
+		// Nothing later can beat a top-priority match in first-match mode
+		if !exhaustive && rule.config.Priority == rules.topPriority {
+			break
+		}
 	}
-	ps.regexCacheLock.RUnlock()
+	return bestIndex
+}
 
-	ps.regexCacheLock.Lock()
-	defer ps.regexCacheLock.Unlock()
+// criteriaMatch reports whether any pattern, regex or structured matcher matches the URL.
+// When exhaustive is set, every pattern is checked so the most specific match is returned.
+// Rules are found through the rule index; this linear check is used for their exclusions.
+func criteriaMatch(criteria urlCriteria, target canonicalURL, exhaustive bool) (bool, specificity) {
+	matched := false
+	var best specificity
+	record := func(spec specificity) bool {
+		if !matched || spec.compare(best) > 0 {
+			best = spec
+		}
+		matched = true
+		return !exhaustive
+	}
 
-	if cached, exists := ps.regexCache[pattern]; exists {
-		return cached, nil
+	for _, pattern := range criteria.patterns {
+		if target.contains(pattern.text) && record(pattern.spec) {
+			return true, best
+		}
 	}
-	compiled, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, err
+	for _, regex := range criteria.regexes {
+		if target.matchRegex(regex.re) && record(regex.spec) {
+			return true, best
+		}
+	}
+	for _, matcher := range criteria.matchers {
+		if matcher.matches(target.parsed) && record(matcher.spec) {
+			return true, best
+		}
 	}
-	ps.regexCache[pattern] = compiled
-	return compiled, nil
+	return matched, best
 }
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// maxRewritePasses bounds how often the rewrite rules are re-applied to a URL
+const maxRewritePasses = 10
+
+// ErrRewriteLoop is returned when rewrite rules keep changing a URL without settling
+var ErrRewriteLoop = errors.New("rewrite rules do not converge")
+
+// rewriteTemplateFuncs are the helper functions available in rewrite templates
+var rewriteTemplateFuncs = template.FuncMap{
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+	"queryEscape": url.QueryEscape,
+	"pathEscape":  url.PathEscape,
+}
+
+// AppliedRewrite records a single rewrite rule changing a URL
+type AppliedRewrite struct {
+	Rule int // Index of the rule in the rewrites list
+	From string
+	To   string
+}
+
+// rewriteTemplateData is the data passed to rewrite templates
+type rewriteTemplateData struct {
+	URL      string
+	Scheme   string
+	Host     string // Host including port
+	Hostname string
+	Port     string
+	Path     string
+	RawQuery string
+	Fragment string
+	Query    url.Values
+	Groups   []string          // Capture groups of find; index 0 is the whole match
+	Named    map[string]string // Named capture groups of find
+}
+
+// compiledRewrite is a rewrite rule ready to be applied
+type compiledRewrite struct {
+	index    int
+	find     *regexp.Regexp
+	replace  string
+	template *template.Template
+}
+
+// RewriteService rewrites URLs with regex find/replace and templated rules
+type RewriteService struct {
+	rules []compiledRewrite
+	lock  sync.RWMutex
+}
+
+// NewRewriteService creates a new RewriteService for the given rules
+func NewRewriteService(rules []RewriteRule) *RewriteService {
+	rs := &RewriteService{}
+	rs.UpdateRules(rules)
+	return rs
+}
+
+// UpdateRules replaces the rewrite rules. Rules that do not compile are logged and skipped.
+func (rs *RewriteService) UpdateRules(rules []RewriteRule) {
+	var compiled []compiledRewrite
+	for i, rule := range rules {
+		c, err := compileRewrite(i, rule)
+		if err != nil {
+			log.Printf("Skipping rewrite %d: %v", i, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	rs.lock.Lock()
+	rs.rules = compiled
+	rs.lock.Unlock()
+}
+
+// compileRewrite compiles the find regex and template of a rewrite rule
+func compileRewrite(index int, rule RewriteRule) (compiledRewrite, error) {
+	find, err := regexp.Compile(rule.Find)
+	if err != nil {
+		return compiledRewrite{}, fmt.Errorf("invalid find pattern %q: %w", rule.Find, err)
+	}
+	c := compiledRewrite{
+		index:   index,
+		find:    find,
+		replace: rule.Replace,
+	}
+	if rule.Template != "" {
+		c.template, err = template.New(fmt.Sprintf("rewrite%d", index)).Funcs(rewriteTemplateFuncs).Option("missingkey=zero").Parse(rule.Template)
+		if err != nil {
+			return compiledRewrite{}, fmt.Errorf("invalid template %q: %w", rule.Template, err)
+		}
+	}
+	return c, nil
+}
+
+// Name returns the name of this stage in the URL pipeline
+func (rs *RewriteService) Name() string {
+	return "rewrite"
+}
+
+// Process rewrites the URL, implementing URLStage
+func (rs *RewriteService) Process(rawURL string) (string, error) {
+	rewritten, _, err := rs.Rewrite(rawURL)
+	return rewritten, err
+}
+
+// Rewrite applies the rules in order, repeating passes until the URL stops changing.
+// If the rules cycle or keep changing the URL for maxRewritePasses passes, the
+// original URL is returned together with ErrRewriteLoop.
+func (rs *RewriteService) Rewrite(rawURL string) (string, []AppliedRewrite, error) {
+	rs.lock.RLock()
+	rules := rs.rules
+	rs.lock.RUnlock()
+
+	current := rawURL
+	seen := map[string]bool{rawURL: true}
+	var applied []AppliedRewrite
+	for pass := 0; pass < maxRewritePasses; pass++ {
+		changed := false
+		for _, rule := range rules {
+			next, err := rule.apply(current)
+			if err != nil {
+				return rawURL, applied, fmt.Errorf("rewrite %d: %w", rule.index, err)
+			}
+			if next == current {
+				continue
+			}
+			applied = append(applied, AppliedRewrite{Rule: rule.index, From: current, To: next})
+			current = next
+			changed = true
+		}
+		if !changed {
+			return current, applied, nil
+		}
+		if seen[current] {
+			return rawURL, applied, fmt.Errorf("%w: %s returned to an earlier URL", ErrRewriteLoop, rawURL)
+		}
+		seen[current] = true
+	}
+	return rawURL, applied, fmt.Errorf("%w: %s still changing after %d passes", ErrRewriteLoop, rawURL, maxRewritePasses)
+}
+
+// apply runs the rule once, returning the URL unchanged when find does not match
+func (c compiledRewrite) apply(rawURL string) (string, error) {
+	if c.template == nil {
+		return c.find.ReplaceAllString(rawURL, c.replace), nil
+	}
+	groups := c.find.FindStringSubmatch(rawURL)
+	if groups == nil {
+		return rawURL, nil
+	}
+	data := rewriteTemplateData{
+		URL:    rawURL,
+		Groups: groups,
+		Named:  make(map[string]string),
+	}
+	for i, name := range c.find.SubexpNames() {
+		if name != "" {
+			data.Named[name] = groups[i]
+		}
+	}
+	if parsed, err := url.Parse(rawURL); err == nil {
+		data.Scheme = parsed.Scheme
+		data.Host = parsed.Host
+		data.Hostname = parsed.Hostname()
+		data.Port = parsed.Port()
+		data.Path = parsed.Path
+		data.RawQuery = parsed.RawQuery
+		data.Fragment = parsed.Fragment
+		data.Query = parsed.Query()
+	}
+	var b strings.Builder
+	if err := c.template.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RuleError describes one invalid entry of the configuration
+type RuleError struct {
+	File    string // Included file the entry comes from, relative to the config directory; empty for the config file itself
+	Section string // Top-level config key, e.g. "browsers"
+	Index   int    // Index of the entry within the section, or -1 for a section that is not a list
+	Field   string // Offending field, e.g. "regexPatterns[1]"
+	Pattern string // The value that failed to compile, if any
+	Err     error
+}
+
+// Error formats the location, value and reason, e.g. browsers[2].regexPatterns[0] "[a": missing closing ].
+// Entries from included files are prefixed with the file name.
+func (e *RuleError) Error() string {
+	location := e.Section
+	if e.Index >= 0 {
+		location += fmt.Sprintf("[%d]", e.Index)
+	}
+	if e.Field != "" {
+		location += "." + e.Field
+	}
+	if e.File != "" {
+		location = e.File + ": " + location
+	}
+	if e.Pattern != "" {
+		return fmt.Sprintf("%s %q: %v", location, e.Pattern, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", location, e.Err)
+}
+
+// Unwrap returns the underlying reason
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors lists every invalid entry found while compiling a configuration
+type ConfigErrors []*RuleError
+
+// Error formats one line per invalid entry
+func (e ConfigErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d invalid config entries:", len(e)))
+	for _, ruleErr := range e {
+		lines = append(lines, "- "+ruleErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// compiledPattern is a lowercased substring pattern
+type compiledPattern struct {
+	source string
+	text   string
+	spec   specificity
+}
+
+// compiledRegex is a compiled regexPatterns entry
+type compiledRegex struct {
+	re   *regexp.Regexp
+	spec specificity
+}
+
+// urlCriteria holds the compiled patterns, regexes and matchers of a rule or of its excludes
+type urlCriteria struct {
+	patterns []compiledPattern
+	regexes  []compiledRegex
+	matchers []compiledMatcher
+}
+
+// compiledRule is a BrowserConfig prepared for matching
+type compiledRule struct {
+	config         BrowserConfig
+	browsers       []string // browserURL followed by browserURLs, without duplicates
+	include        urlCriteria
+	exclude        urlCriteria
+	schedule       *compiledSchedule
+	network        *compiledNetwork
+	hasURLCriteria bool
+	hasConditions  bool
+	conditions     int
+	disabled       bool // A condition failed to compile, so the rule never matches
+}
+
+// CompiledRules is a configuration whose rules have been validated and compiled for matching
+type CompiledRules struct {
+	config      Config
+	rules       []compiledRule
+	index       *ruleIndex
+	topPriority int
+	defaultApps map[string]string // By lower-case scheme
+	askTimeout  time.Duration     // Zero if not configured
+}
+
+// Config returns the configuration the rules were compiled from
+func (cr *CompiledRules) Config() Config {
+	return cr.config
+}
+
+// AskTimeout returns how long a link waits for the user to choose a browser, or zero for the default
+func (cr *CompiledRules) AskTimeout() time.Duration {
+	return cr.askTimeout
+}
+
+// CompileRules validates a configuration and compiles its rules.
+// Invalid entries are left out of the result and reported together as ConfigErrors,
+// so callers can either reject the configuration or use the valid part of it.
+func CompileRules(config Config) (*CompiledRules, error) {
+	var errs ConfigErrors
+	report := func(section string, index int, field, pattern string, err error) {
+		errs = append(errs, &RuleError{Section: section, Index: index, Field: field, Pattern: pattern, Err: err})
+	}
+
+	if config.MatchMode != "" && config.MatchMode != MatchModeFirst && config.MatchMode != MatchModeSpecific {
+		errs = append(errs, &RuleError{Section: "matchMode", Index: -1, Err: fmt.Errorf("unknown match mode %q, expected %q or %q", config.MatchMode, MatchModeFirst, MatchModeSpecific)})
+	}
+	if config.LogLevel != "" && config.LogLevel != LogLevelInfo && config.LogLevel != LogLevelDebug {
+		errs = append(errs, &RuleError{Section: "logLevel", Index: -1, Err: fmt.Errorf("unknown log level %q, expected %q or %q", config.LogLevel, LogLevelInfo, LogLevelDebug)})
+	}
+
+	compiled := &CompiledRules{config: config}
+	if config.AskTimeout != "" {
+		timeout, err := time.ParseDuration(config.AskTimeout)
+		if err == nil && timeout <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			errs = append(errs, &RuleError{Section: "askTimeout", Index: -1, Pattern: config.AskTimeout, Err: err})
+		} else {
+			compiled.askTimeout = timeout
+		}
+	}
+	for i, browserConfig := range config.Browsers {
+		rule := compiledRule{
+			config:         browserConfig,
+			browsers:       ruleBrowsers(browserConfig),
+			hasURLCriteria: hasURLCriteria(browserConfig),
+			hasConditions:  hasConditions(browserConfig),
+			conditions:     conditionSpecificity(browserConfig),
+		}
+		rule.include = compileCriteria(browserConfig.Patterns, browserConfig.RegexPatterns, browserConfig.Matchers, "", func(field, pattern string, err error) {
+			report("browsers", i, field, pattern, err)
+		})
+		rule.exclude = compileCriteria(browserConfig.ExcludePatterns, browserConfig.ExcludeRegexPatterns, browserConfig.ExcludeMatchers, "exclude", func(field, pattern string, err error) {
+			report("browsers", i, field, pattern, err)
+		})
+		if browserConfig.Open != "" && browserConfig.Open != OpenFirst && browserConfig.Open != OpenAll {
+			report("browsers", i, "open", "", fmt.Errorf("unknown open mode %q, expected %q or %q", browserConfig.Open, OpenFirst, OpenAll))
+		}
+		if browserConfig.Schedule != nil {
+			schedule, err := compileSchedule(browserConfig.Schedule)
+			if err != nil {
+				report("browsers", i, "schedule", "", err)
+				rule.disabled = true
+			}
+			rule.schedule = schedule
+		}
+		if browserConfig.Network != nil {
+			network, err := compileNetwork(browserConfig.Network)
+			if err != nil {
+				report("browsers", i, "network", "", err)
+				rule.disabled = true
+			}
+			rule.network = network
+		}
+		if i == 0 || browserConfig.Priority > compiled.topPriority {
+			compiled.topPriority = browserConfig.Priority
+		}
+		compiled.rules = append(compiled.rules, rule)
+	}
+	compiled.index = buildRuleIndex(compiled.rules)
+
+	compiled.defaultApps = make(map[string]string)
+	for scheme, app := range config.DefaultApps {
+		switch {
+		case !isValidScheme(scheme):
+			errs = append(errs, &RuleError{Section: "defaultApps", Index: -1, Field: scheme, Err: errors.New("not a valid URL scheme")})
+		case strings.TrimSpace(app) == "":
+			errs = append(errs, &RuleError{Section: "defaultApps", Index: -1, Field: scheme, Err: errors.New("an application path is required")})
+		default:
+			compiled.defaultApps[strings.ToLower(scheme)] = app
+		}
+	}
+
+	for i, rewrite := range config.Rewrites {
+		if _, err := compileRewrite(i, rewrite); err != nil {
+			report("rewrites", i, "", "", err)
+		}
+	}
+	for i, wrapper := range config.Wrappers {
+		// A trailing ".*" ("google.*") matches the redirector on every country domain
+		if strings.TrimSpace(wrapper.Host) == "" {
+			report("wrappers", i, "host", "", errors.New("a host is required"))
+		} else if err := validateHostPattern(strings.TrimSuffix(wrapper.Host, ".*")); err != nil {
+			report("wrappers", i, "host", wrapper.Host, err)
+		}
+		if strings.TrimSpace(wrapper.Param) == "" {
+			report("wrappers", i, "param", "", errors.New("a query parameter is required"))
+		}
+	}
+	if config.Shorteners != nil {
+		for i, host := range config.Shorteners.Hosts {
+			if err := validateHostPattern(host); err != nil {
+				report("shorteners", -1, fmt.Sprintf("hosts[%d]", i), host, err)
+			}
+		}
+	}
+
+	for i, subscription := range config.Subscriptions {
+		validateSubscription(subscription, func(field, pattern string, err error) {
+			report("subscriptions", i, field, pattern, err)
+		})
+	}
+
+	if len(errs) > 0 {
+		return compiled, errs
+	}
+	return compiled, nil
+}
+
+// ruleBrowsers returns every browser a rule names, in order and without duplicates
+func ruleBrowsers(config BrowserConfig) []string {
+	browsers := make([]string, 0, 1+len(config.BrowserURLs))
+	for _, browser := range append([]string{config.BrowserURL}, config.BrowserURLs...) {
+		if browser != "" && !slices.Contains(browsers, browser) {
+			browsers = append(browsers, browser)
+		}
+	}
+	return browsers
+}
+
+// compileCriteria compiles patterns, regexes and matchers, reporting and skipping invalid ones.
+// prefix is prepended to the field names, e.g. "exclude" gives "excludeRegexPatterns".
+func compileCriteria(patterns, regexPatterns []string, matchers []URLMatcher, prefix string, report func(field, pattern string, err error)) urlCriteria {
+	fieldName := func(name string, index int) string {
+		if prefix != "" {
+			name = prefix + strings.ToUpper(name[:1]) + name[1:]
+		}
+		return fmt.Sprintf("%s[%d]", name, index)
+	}
+
+	var criteria urlCriteria
+	for _, pattern := range patterns {
+		criteria.patterns = append(criteria.patterns, compiledPattern{source: pattern, text: strings.ToLower(pattern), spec: patternSpecificity(pattern)})
+	}
+	for j, regexPattern := range regexPatterns {
+		re, err := regexp.Compile(regexPattern)
+		if err != nil {
+			report(fieldName("regexPatterns", j), regexPattern, regexReason(err))
+			continue
+		}
+		criteria.regexes = append(criteria.regexes, compiledRegex{re: re, spec: patternSpecificity(regexPattern)})
+	}
+	for j, matcher := range matchers {
+		compiledMatcher, err := compileMatcher(matcher)
+		if err != nil {
+			report(fieldName("matchers", j), "", err)
+			continue
+		}
+		criteria.matchers = append(criteria.matchers, compiledMatcher)
+	}
+	return criteria
+}
+
+// regexReason shortens a regexp syntax error to its reason, since the pattern is reported separately
+func regexReason(err error) error {
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%s in `%s`", syntaxErr.Code, syntaxErr.Expr)
+	}
+	return err
+}
+
+// isValidScheme reports whether s is a URL scheme: a letter followed by letters, digits, "+", "-" or "." (RFC 3986)
+func isValidScheme(s string) bool {
+	for i, c := range s {
+		letter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if !letter && (i == 0 || !('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validateHostPattern checks that a host only uses a wildcard as a leading "*."
+func validateHostPattern(host string) error {
+	if strings.Contains(strings.TrimPrefix(normalizeHost(strings.TrimSpace(host)), "*."), "*") {
+		return errors.New("a wildcard is only allowed as a leading \"*.\"")
+	}
+	return nil
+}
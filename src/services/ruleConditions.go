@@ -0,0 +1,91 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// evaluation holds the state shared by all rules while resolving one request
+type evaluation struct {
+	request      URLRequest
+	now          time.Time
+	network      NetworkStateProvider
+	networkState *NetworkState
+}
+
+// newEvaluation captures the current time for a request; network state is read lazily
+func (ps *PatternService) newEvaluation(request URLRequest) *evaluation {
+	return &evaluation{
+		request: request,
+		now:     ps.clock.Now(),
+		network: ps.networkState,
+	}
+}
+
+// snapshot returns the network state, reading it at most once per evaluation
+func (e *evaluation) snapshot() NetworkState {
+	if e.networkState == nil {
+		state, err := e.network.Snapshot()
+		if err != nil {
+			log.Printf("Cannot read network state: %v", err)
+		}
+		e.networkState = &state
+	}
+	return *e.networkState
+}
+
+// hasConditions reports whether the rule has any non-URL conditions
+func hasConditions(browserConfig BrowserConfig) bool {
+	return len(browserConfig.SourceApps) > 0 || browserConfig.Schedule != nil || browserConfig.Network != nil
+}
+
+// hasURLCriteria reports whether the rule has any patterns, regexes or matchers
+func hasURLCriteria(browserConfig BrowserConfig) bool {
+	return len(browserConfig.Patterns) > 0 || len(browserConfig.RegexPatterns) > 0 || len(browserConfig.Matchers) > 0
+}
+
+// conditionsMet reports whether every condition of the rule holds for the request
+func conditionsMet(rule *compiledRule, eval *evaluation) bool {
+	if rule.disabled {
+		return false
+	}
+	if len(rule.config.SourceApps) > 0 && !sourceAppMatches(rule.config.SourceApps, eval.request.SourceApp) {
+		return false
+	}
+	if rule.schedule != nil && !rule.schedule.active(eval.now) {
+		return false
+	}
+	if rule.network != nil && !rule.network.met(eval.snapshot()) {
+		return false
+	}
+	return true
+}
+
+// conditionSpecificity counts the conditions of a rule, so conditional rules beat unconditional ones
+func conditionSpecificity(browserConfig BrowserConfig) int {
+	count := 0
+	if len(browserConfig.SourceApps) > 0 {
+		count++
+	}
+	if browserConfig.Schedule != nil {
+		count++
+	}
+	if browserConfig.Network != nil {
+		count++
+	}
+	return count
+}
+
+// sourceAppMatches reports whether the sending app's bundle identifier is in the list (case-insensitive)
+func sourceAppMatches(sourceApps []string, sourceApp string) bool {
+	if sourceApp == "" {
+		return false
+	}
+	for _, app := range sourceApps {
+		if strings.EqualFold(app, sourceApp) {
+			return true
+		}
+	}
+	return false
+}
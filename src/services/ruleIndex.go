@@ -0,0 +1,330 @@
+package services
+
+import (
+	"log"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRegexSetLength bounds the source length of the combined regex prefilter
+const maxRegexSetLength = 1 << 20
+
+// Kinds of rule criteria referenced by the index
+const (
+	criterionPattern = iota
+	criterionRegex
+	criterionMatcher
+)
+
+// criterionRef points at one pattern, regex or matcher of a rule
+type criterionRef struct {
+	rule  int32
+	kind  int8
+	index int32
+}
+
+// ruleCandidate is a rule that may match, with the criteria that still need to be checked
+type ruleCandidate struct {
+	rule int
+	refs []criterionRef
+}
+
+// ruleIndex narrows the rules that can match a URL so only their candidate criteria are checked.
+// Substring patterns and literals required by regexes are found with one Aho-Corasick pass,
+// matcher hosts and domains are looked up in a trie of reversed host labels, and regexes
+// without a usable literal are prefiltered by a single combined regex.
+type ruleIndex struct {
+	substrings     *ahoCorasick
+	substringRefs  [][]criterionRef // Per substring id
+	hosts          *hostTrieNode
+	regexSet       *regexp.Regexp // Matches if any regex in regexSetRefs may match; nil checks them all
+	regexSetRefs   []criterionRef
+	alwaysRefs     []criterionRef // Criteria that are checked for every URL
+	conditionRules []int          // Rules that match on their conditions alone
+}
+
+// hostTrieNode is a node of a trie keyed by host labels from the top-level domain down
+type hostTrieNode struct {
+	children map[string]*hostTrieNode
+	exact    []criterionRef // Matchers for exactly this host
+	wildcard []criterionRef // Matchers for subdomains of this host ("*.example.com")
+	domain   []criterionRef // Matchers for this registrable domain and its subdomains
+}
+
+// buildRuleIndex indexes the include criteria of the rules
+func buildRuleIndex(rules []compiledRule) *ruleIndex {
+	index := &ruleIndex{hosts: &hostTrieNode{}}
+	var substrings []string
+	substringIDs := make(map[string]int)
+	addSubstring := func(text string, ref criterionRef) {
+		id, ok := substringIDs[text]
+		if !ok {
+			id = len(substrings)
+			substringIDs[text] = id
+			substrings = append(substrings, text)
+			index.substringRefs = append(index.substringRefs, nil)
+		}
+		index.substringRefs[id] = append(index.substringRefs[id], ref)
+	}
+
+	var setSources []string
+	for i := range rules {
+		rule := &rules[i]
+		if rule.disabled {
+			continue
+		}
+		if !rule.hasURLCriteria {
+			if rule.hasConditions {
+				index.conditionRules = append(index.conditionRules, i)
+			}
+			continue
+		}
+		for j, pattern := range rule.include.patterns {
+			ref := criterionRef{rule: int32(i), kind: criterionPattern, index: int32(j)}
+			if pattern.text == "" {
+				index.alwaysRefs = append(index.alwaysRefs, ref) // Matches every URL
+				continue
+			}
+			addSubstring(pattern.text, ref)
+		}
+		for j, regex := range rule.include.regexes {
+			ref := criterionRef{rule: int32(i), kind: criterionRegex, index: int32(j)}
+			if literal := requiredLiteral(regex.re.String()); literal != "" {
+				addSubstring(literal, ref)
+				continue
+			}
+			index.regexSetRefs = append(index.regexSetRefs, ref)
+			setSources = append(setSources, "(?:"+regex.re.String()+")")
+		}
+		for j, matcher := range rule.include.matchers {
+			ref := criterionRef{rule: int32(i), kind: criterionMatcher, index: int32(j)}
+			switch {
+			case matcher.host != "":
+				if suffix, ok := strings.CutPrefix(matcher.host, "*."); ok {
+					node := index.hosts.insert(suffix)
+					node.wildcard = append(node.wildcard, ref)
+				} else {
+					node := index.hosts.insert(matcher.host)
+					node.exact = append(node.exact, ref)
+				}
+			case matcher.domain != "":
+				node := index.hosts.insert(matcher.domain)
+				node.domain = append(node.domain, ref)
+			default:
+				index.alwaysRefs = append(index.alwaysRefs, ref)
+			}
+		}
+	}
+
+	index.substrings = newAhoCorasick(substrings)
+	if len(setSources) > 1 {
+		source := strings.Join(setSources, "|")
+		if len(source) <= maxRegexSetLength {
+			set, err := regexp.Compile(source)
+			if err != nil {
+				log.Printf("Cannot combine regex patterns, checking them one by one: %v", err)
+			}
+			index.regexSet = set
+		}
+	}
+	return index
+}
+
+// candidates returns the rules whose criteria may match the URL, in config order
+func (index *ruleIndex) candidates(target canonicalURL) []ruleCandidate {
+	refs := slices.Clone(index.alwaysRefs)
+	seen := make(map[int32]bool)
+	found := func(id int32) {
+		if !seen[id] {
+			seen[id] = true
+			refs = append(refs, index.substringRefs[id]...)
+		}
+	}
+	index.substrings.match(target.lower, found)
+	if target.unicode != "" {
+		index.substrings.match(target.unicodeLower, found)
+	}
+	if target.originalLower != "" && target.originalLower != target.lower {
+		// Regexes also match the URL as given, so their literals are looked for in it too.
+		// Substring patterns only match the canonical forms.
+		seenOriginal := make(map[int32]bool)
+		index.substrings.match(target.originalLower, func(id int32) {
+			if seen[id] || seenOriginal[id] {
+				return
+			}
+			seenOriginal[id] = true
+			for _, ref := range index.substringRefs[id] {
+				if ref.kind == criterionRegex {
+					refs = append(refs, ref)
+				}
+			}
+		})
+	}
+	if len(index.regexSetRefs) > 0 && (index.regexSet == nil || target.matchRegex(index.regexSet)) {
+		refs = append(refs, index.regexSetRefs...)
+	}
+	if target.parsed != nil {
+		refs = index.hosts.lookup(normalizeHost(target.parsed.Hostname()), refs)
+	}
+
+	slices.SortFunc(refs, func(a, b criterionRef) int {
+		if a.rule != b.rule {
+			return int(a.rule - b.rule)
+		}
+		if a.kind != b.kind {
+			return int(a.kind - b.kind)
+		}
+		return int(a.index - b.index)
+	})
+
+	var result []ruleCandidate
+	conditionRules := index.conditionRules
+	for start := 0; start < len(refs); {
+		rule := int(refs[start].rule)
+		end := start
+		for end < len(refs) && int(refs[end].rule) == rule {
+			end++
+		}
+		for len(conditionRules) > 0 && conditionRules[0] < rule {
+			result = append(result, ruleCandidate{rule: conditionRules[0]})
+			conditionRules = conditionRules[1:]
+		}
+		result = append(result, ruleCandidate{rule: rule, refs: refs[start:end]})
+		start = end
+	}
+	for _, rule := range conditionRules {
+		result = append(result, ruleCandidate{rule: rule})
+	}
+	return result
+}
+
+// insert returns the node for a host, creating the path of reversed labels as needed
+func (node *hostTrieNode) insert(host string) *hostTrieNode {
+	labels := strings.Split(host, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, ok := node.children[labels[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*hostTrieNode)
+			}
+			child = &hostTrieNode{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// lookup appends the matchers that may match the host to refs
+func (node *hostTrieNode) lookup(host string, refs []criterionRef) []criterionRef {
+	if host == "" {
+		return refs
+	}
+	labels := strings.Split(host, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, ok := node.children[labels[i]]
+		if !ok {
+			return refs
+		}
+		node = child
+		refs = append(refs, node.domain...)
+		if i > 0 {
+			refs = append(refs, node.wildcard...)
+		}
+	}
+	return append(refs, node.exact...)
+}
+
+// verify checks the candidate criteria of a rule, returning whether one matched and the
+// most specific match. Unless exhaustive is set, it stops at the first match.
+func (candidate ruleCandidate) verify(rule *compiledRule, target canonicalURL, exhaustive bool) (bool, specificity) {
+	matched := false
+	var best specificity
+	for _, ref := range candidate.refs {
+		var ok bool
+		var spec specificity
+		switch ref.kind {
+		case criterionPattern:
+			ok, spec = true, rule.include.patterns[ref.index].spec // Found by the automaton
+		case criterionRegex:
+			regex := rule.include.regexes[ref.index]
+			ok, spec = target.matchRegex(regex.re), regex.spec
+		case criterionMatcher:
+			matcher := rule.include.matchers[ref.index]
+			ok, spec = matcher.matches(target.parsed), matcher.spec
+		}
+		if !ok {
+			continue
+		}
+		if !matched || spec.compare(best) > 0 {
+			best = spec
+		}
+		matched = true
+		if !exhaustive {
+			break
+		}
+	}
+	return matched, best
+}
+
+// requiredLiteral returns a lowercased substring that every match of the regex contains,
+// or "" if there is none that can be found in the lowercased URL.
+func requiredLiteral(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(longestLiteral(re))
+}
+
+// longestLiteral returns the longest literal that is part of every match of re
+func longestLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 && !isASCII(re.Rune) {
+			return "" // Case folding beyond ASCII does not agree with strings.ToLower
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return longestLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return longestLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		longest, run := "", ""
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				literal := longestLiteral(sub)
+				if literal == "" {
+					run = ""
+					continue
+				}
+				run += literal
+				if len(run) > len(longest) {
+					longest = run
+				}
+				continue
+			}
+			run = ""
+			if literal := longestLiteral(sub); len(literal) > len(longest) {
+				longest = literal
+			}
+		}
+		return longest
+	}
+	return ""
+}
+
+// isASCII reports whether all runes are ASCII
+func isASCII(runes []rune) bool {
+	for _, r := range runes {
+		if r >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"strings"
+)
+
+// Match modes for resolving a URL that matches more than one browser rule
+const (
+	MatchModeFirst    = "first"    // Highest priority wins, then the earliest rule in the config (default)
+	MatchModeSpecific = "specific" // Highest priority wins, then the most specific match, then the earliest rule
+)
+
+// Host kinds, ordered from least to most specific
+const (
+	hostKindNone = iota
+	hostKindPattern
+	hostKindDomain
+	hostKindWildcard
+	hostKindExact
+)
+
+// specificity ranks how precisely a matching pattern pins down a URL.
+// Fields are compared in declaration order; the first difference decides.
+type specificity struct {
+	hostKind   int // How the host was matched (exact > wildcard > registrable domain > substring/regex > none)
+	hostLabels int // Number of host labels fixed by the pattern ("*.docs.google.com" beats "*.google.com")
+	pathLength int // Literal characters in the path prefix or glob (longer prefix beats shorter)
+	conditions int // Extra constraints satisfied: scheme, port and query parameters
+	literal    int // Length of a substring or regex pattern, the weakest signal
+}
+
+// compare returns -1, 0 or 1 when s is less, equally or more specific than other
+func (s specificity) compare(other specificity) int {
+	a := [...]int{s.hostKind, s.hostLabels, s.pathLength, s.conditions, s.literal}
+	b := [...]int{other.hostKind, other.hostLabels, other.pathLength, other.conditions, other.literal}
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] > b[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// patternSpecificity ranks a substring or regex pattern below any structured host match
+func patternSpecificity(pattern string) specificity {
+	return specificity{hostKind: hostKindPattern, literal: len(pattern)}
+}
+
+// matcherSpecificity ranks a structured matcher by the URL parts it constrains
+func matcherSpecificity(m URLMatcher) specificity {
+	var s specificity
+	switch host := normalizeHost(m.Host); {
+	case host == "":
+	case strings.HasPrefix(host, "*."):
+		s.hostKind = hostKindWildcard
+		s.hostLabels = strings.Count(host, ".")
+	default:
+		s.hostKind = hostKindExact
+		s.hostLabels = strings.Count(host, ".") + 1
+	}
+	if s.hostKind == hostKindNone && m.Domain != "" {
+		s.hostKind = hostKindDomain
+		s.hostLabels = strings.Count(normalizeHost(m.Domain), ".") + 1
+	}
+	s.pathLength = len(m.Path) - strings.Count(m.Path, "*") - strings.Count(m.Path, "?")
+	if m.Scheme != "" {
+		s.conditions++
+	}
+	if m.Port != "" {
+		s.conditions++
+	}
+	s.conditions += len(m.Query)
+	return s
+}
+
+// isBetterMatch reports whether a candidate rule should replace the current best match.
+// Ties are broken deterministically: higher priority first, then (in specific mode)
+// higher specificity, and otherwise the rule listed earlier in the config keeps winning,
+// because candidates are visited in config order and only a strictly better one replaces it.
+func isBetterMatch(mode string, candidate BrowserConfig, candidateSpec specificity, best BrowserConfig, bestSpec specificity) bool {
+	if candidate.Priority != best.Priority {
+		return candidate.Priority > best.Priority
+	}
+	if mode == MatchModeSpecific {
+		return candidateSpec.compare(bestSpec) > 0
+	}
+	return false
+}
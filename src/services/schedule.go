@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Clock provides the current time, so schedule conditions can be tested deterministically
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the production Clock backed by time.Now
+type realClock struct{}
+
+// Now returns the current time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// weekdayNames maps accepted weekday spellings to time.Weekday
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// compiledSchedule is a Schedule with its days, windows and time zone parsed
+type compiledSchedule struct {
+	days     map[time.Weekday]bool // nil means every day
+	windows  [][2]int              // Minutes since midnight; empty means all day
+	location *time.Location        // nil means local time
+}
+
+// compileSchedule validates a Schedule and prepares it for evaluation
+func compileSchedule(schedule *Schedule) (*compiledSchedule, error) {
+	c := &compiledSchedule{}
+	if schedule.TimeZone != "" {
+		location, err := time.LoadLocation(schedule.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", schedule.TimeZone)
+		}
+		c.location = location
+	}
+	if len(schedule.Weekdays) > 0 {
+		days, err := parseWeekdays(schedule.Weekdays)
+		if err != nil {
+			return nil, err
+		}
+		c.days = days
+	}
+	for _, window := range schedule.Hours {
+		start, end, err := parseTimeWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		c.windows = append(c.windows, [2]int{start, end})
+	}
+	return c, nil
+}
+
+// active reports whether the schedule allows the rule at the given time.
+// The weekday is taken at that moment, so a window that wraps past midnight
+// ("22:00"-"02:00") continues into the early hours of the following day only if
+// that day is also listed.
+func (c *compiledSchedule) active(now time.Time) bool {
+	if c.location != nil {
+		now = now.In(c.location)
+	}
+	if c.days != nil && !c.days[now.Weekday()] {
+		return false
+	}
+	if len(c.windows) == 0 {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range c.windows {
+		start, end := window[0], window[1]
+		if start <= end && minute >= start && minute < end {
+			return true
+		}
+		if start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeekdays parses day names ("mon", "Tuesday") and ranges ("mon-fri") into a set
+func parseWeekdays(names []string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, name := range names {
+		fromName, toName, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(name)), "-")
+		from, ok := weekdayNames[strings.TrimSpace(fromName)]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", name)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[strings.TrimSpace(toName)]; !ok {
+				return nil, fmt.Errorf("unknown weekday %q", name)
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeWindow returns the start and end of a window in minutes since midnight
+func parseTimeWindow(window TimeWindow) (int, int, error) {
+	start, err := parseClockTime(window.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClockTime(window.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseClockTime parses "15:04" into minutes since midnight; "24:00" is accepted as end of day
+func parseClockTime(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for resolving shortened URLs
+const (
+	defaultShortenerTimeout = 2 * time.Second
+	defaultShortenerMaxHops = 5
+	defaultShortenerCache   = time.Hour
+)
+
+// ErrTooManyRedirects is returned when a short link redirects more often than allowed
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// shortenerCacheEntry is a resolved short link and when it expires
+type shortenerCacheEntry struct {
+	target  string
+	expires time.Time
+}
+
+// ShortenerResolver expands short links (bit.ly, t.co, go-links) by following their redirects
+type ShortenerResolver struct {
+	config ShortenerConfig
+	client *http.Client
+	clock  Clock
+	cache  map[string]shortenerCacheEntry
+	lock   sync.Mutex
+}
+
+// NewShortenerResolver creates a new ShortenerResolver using a default HTTP client
+func NewShortenerResolver(config *ShortenerConfig) *ShortenerResolver {
+	return NewShortenerResolverWithClient(config, &http.Client{})
+}
+
+// NewShortenerResolverWithClient creates a new ShortenerResolver with a custom HTTP client (for testing).
+// Redirects are followed by the resolver itself, so the client's redirect policy is replaced.
+func NewShortenerResolverWithClient(config *ShortenerConfig, client *http.Client) *ShortenerResolver {
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	sr := &ShortenerResolver{
+		client: &noFollow,
+		clock:  realClock{},
+	}
+	sr.UpdateConfig(config)
+	return sr
+}
+
+// UpdateConfig replaces the shortener configuration and clears the cache; nil disables resolving
+func (sr *ShortenerResolver) UpdateConfig(config *ShortenerConfig) {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.config = ShortenerConfig{}
+	if config != nil {
+		sr.config = *config
+	}
+	sr.cache = make(map[string]shortenerCacheEntry)
+}
+
+// Name returns the name of this stage in the URL pipeline
+func (sr *ShortenerResolver) Name() string {
+	return "shortener"
+}
+
+// Process expands the URL, implementing URLStage
+func (sr *ShortenerResolver) Process(rawURL string) (string, error) {
+	return sr.Resolve(rawURL)
+}
+
+// Resolve follows the redirects of a short link while they stay on shortener hosts.
+// URLs on other hosts are returned unchanged without any network access.
+func (sr *ShortenerResolver) Resolve(rawURL string) (string, error) {
+	sr.lock.Lock()
+	config := sr.config
+	entry, cached := sr.cache[rawURL]
+	sr.lock.Unlock()
+
+	if !sr.isShortener(config, rawURL) {
+		return rawURL, nil
+	}
+	now := sr.clock.Now()
+	if cached && now.Before(entry.expires) {
+		return entry.target, nil
+	}
+
+	timeout := defaultShortenerTimeout
+	if config.TimeoutMs > 0 {
+		timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+	}
+	maxHops := defaultShortenerMaxHops
+	if config.MaxHops > 0 {
+		maxHops = config.MaxHops
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	current := rawURL
+	for hops := 0; sr.isShortener(config, current); hops++ {
+		if hops == maxHops {
+			return rawURL, fmt.Errorf("%w resolving %s (limit %d)", ErrTooManyRedirects, rawURL, maxHops)
+		}
+		next, err := sr.nextLocation(ctx, current)
+		if err != nil {
+			return rawURL, err
+		}
+		if next == "" {
+			break // Not a redirect: the shortener itself is the destination
+		}
+		current = next
+	}
+
+	cacheFor := defaultShortenerCache
+	if config.CacheMinutes > 0 {
+		cacheFor = time.Duration(config.CacheMinutes) * time.Minute
+	}
+	sr.lock.Lock()
+	sr.cache[rawURL] = shortenerCacheEntry{target: current, expires: now.Add(cacheFor)}
+	sr.lock.Unlock()
+	return current, nil
+}
+
+// nextLocation returns the redirect target of a URL, or "" when it does not redirect.
+// It tries HEAD first and falls back to GET for servers that do not support HEAD.
+func (sr *ShortenerResolver) nextLocation(ctx context.Context, rawURL string) (string, error) {
+	resp, err := sr.request(ctx, http.MethodHead, rawURL)
+	if err != nil || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		resp, err = sr.request(ctx, http.MethodGet, rawURL)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("redirect from %s without a valid location: %w", rawURL, err)
+	}
+	return location.String(), nil
+}
+
+// request sends a single request and closes the body; only the status and headers are needed
+func (sr *ShortenerResolver) request(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "brb")
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// isShortener reports whether the URL is a web URL on one of the configured shortener hosts
+func (sr *ShortenerResolver) isShortener(config ShortenerConfig, rawURL string) bool {
+	if len(config.Hosts) == 0 || !isWebURL(rawURL) {
+		return false
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := normalizeHost(parsed.Hostname())
+	for _, pattern := range config.Hosts {
+		if hostMatches(strings.TrimSpace(pattern), host) {
+			return true
+		}
+	}
+	return false
+}
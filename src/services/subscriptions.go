@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Defaults for rule pack subscriptions
+const (
+	defaultSubscriptionRefresh = 6 * time.Hour
+	subscriptionRetry          = 5 * time.Minute  // Wait before retrying a failed sync, if shorter than the refresh interval
+	subscriptionTimeout        = 30 * time.Second // Time allowed for downloading one pack
+	maxSubscriptionSize        = 10 << 20
+	maxSignatureSize           = 1 << 10
+)
+
+// subscriptionState is what is remembered about a subscription between syncs, next to its cached pack
+type subscriptionState struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Checks       string    `json:"checks,omitempty"` // Checksum and key the cached pack was verified with
+	SyncedAt     time.Time `json:"syncedAt"`         // Last time the cached pack was confirmed to be current
+	CheckedAt    time.Time `json:"checkedAt"`        // Last sync attempt, successful or not
+	Error        string    `json:"error,omitempty"`  // Why the last attempt failed
+}
+
+// SubscriptionStatus describes a subscribed rule pack
+type SubscriptionStatus struct {
+	URL      string
+	SyncedAt time.Time // Zero if the pack was never synced
+	Cached   bool      // A copy of the pack is available offline
+	Err      string    // Why the last sync failed; empty if it succeeded
+}
+
+// SetHTTPClient replaces the client used to download rule packs (for testing)
+func (cs *ConfigService) SetHTTPClient(client *http.Client) {
+	cs.httpClient = client
+}
+
+// SetClock replaces the clock used to decide when rule packs are due for a refresh (for testing)
+func (cs *ConfigService) SetClock(clock Clock) {
+	cs.clock = clock
+}
+
+// Subscriptions returns the state of every subscribed rule pack
+func (cs *ConfigService) Subscriptions() []SubscriptionStatus {
+	subscriptions, configPath := cs.subscriptions()
+	var statuses []SubscriptionStatus
+	for _, subscription := range subscriptions {
+		file := subscriptionFile(subscriptionCacheDir(configPath), subscription.URL)
+		state := readSubscriptionState(file)
+		_, err := os.Stat(file)
+		statuses = append(statuses, SubscriptionStatus{URL: subscription.URL, SyncedAt: state.SyncedAt, Cached: err == nil, Err: state.Error})
+	}
+	return statuses
+}
+
+// SyncSubscriptions downloads the rule packs that are due for a refresh, or all of them when force is set.
+// It reports whether a cached pack changed; Load merges the new packs into the config.
+// A pack that cannot be downloaded or verified keeps its cached copy, and the problem is returned.
+func (cs *ConfigService) SyncSubscriptions(force bool) (bool, error) {
+	cs.syncLock.Lock()
+	defer cs.syncLock.Unlock()
+
+	// The config may be reloaded while packs download, so the list is taken up front
+	subscriptions, configPath := cs.subscriptions()
+	cacheDir := subscriptionCacheDir(configPath)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return false, err
+	}
+	changed := false
+	var errs []error
+	for _, subscription := range subscriptions {
+		file := subscriptionFile(cacheDir, subscription.URL)
+		state := readSubscriptionState(file)
+		now := cs.clock.Now()
+		if !force && !subscriptionDue(subscription, state, now) {
+			continue
+		}
+
+		updated, err := cs.syncSubscription(subscription, file, &state)
+		state.URL, state.CheckedAt, state.Error = subscription.URL, now, ""
+		if err != nil {
+			state.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", subscription.URL, err))
+		} else {
+			state.SyncedAt = now
+		}
+		if err := writeSubscriptionState(file, state); err != nil {
+			log.Printf("Cannot save the sync state of %s: %v", subscription.URL, err)
+		}
+		changed = changed || updated
+	}
+	return changed, errors.Join(errs...)
+}
+
+// RunSubscriptions syncs the rule packs that are due every interval until stop is closed,
+// starting right away. onSync is called after every round in which a pack was checked.
+func (cs *ConfigService) RunSubscriptions(interval time.Duration, stop <-chan struct{}, onSync func(changed bool, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if subscriptions, _ := cs.subscriptions(); len(subscriptions) > 0 {
+			changed, err := cs.SyncSubscriptions(false)
+			if onSync != nil {
+				onSync(changed, err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// subscriptions returns the subscribed rule packs of the current config and the config file path
+func (cs *ConfigService) subscriptions() ([]Subscription, string) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return cs.config.Subscriptions, cs.configPath
+}
+
+// syncSubscription downloads a rule pack unless the server reports that the cached copy is current,
+// and reports whether the cached copy changed
+func (cs *ConfigService) syncSubscription(subscription Subscription, file string, state *subscriptionState) (bool, error) {
+	header := make(http.Header)
+	checks := subscription.SHA256 + " " + subscription.PublicKey
+	if _, err := os.Stat(file); err == nil && state.Checks == checks {
+		// Only ask for changes when the cached copy can be used as it is
+		if state.ETag != "" {
+			header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+	resp, body, err := cs.download(subscription.URL, header, maxSubscriptionSize)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	if err := cs.verifySubscription(subscription, body); err != nil {
+		return false, err
+	}
+	if _, err := decodeConfigDocument(stripJSONC(body)); err != nil {
+		return false, fmt.Errorf("invalid rule pack: %w", err)
+	}
+	state.ETag, state.LastModified, state.Checks = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), checks
+	if cached, err := os.ReadFile(file); err == nil && bytes.Equal(cached, body) {
+		return false, nil
+	}
+	if err := writeFileAtomic(file, body); err != nil {
+		return false, fmt.Errorf("cannot cache the rule pack: %w", err)
+	}
+	return true, nil
+}
+
+// verifySubscription checks a downloaded pack against the configured checksum and signature
+func (cs *ConfigService) verifySubscription(subscription Subscription, body []byte) error {
+	if subscription.SHA256 != "" {
+		sum := sha256.Sum256(body)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, subscription.SHA256) {
+			return fmt.Errorf("checksum mismatch: the pack has SHA-256 %s", got)
+		}
+	}
+	if subscription.PublicKey == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(subscription.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("publicKey is not a base64 Ed25519 public key")
+	}
+	signatureURL := subscription.SignatureURL
+	if signatureURL == "" {
+		signatureURL = subscription.URL + ".sig"
+	}
+	resp, encoded, err := cs.download(signatureURL, nil, maxSignatureSize)
+	if err != nil {
+		return fmt.Errorf("cannot download the signature: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download the signature: %s", resp.Status)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(key, body, signature) {
+		return errors.New("the signature does not match the pack")
+	}
+	return nil
+}
+
+// download fetches a URL and reads up to limit bytes of its body. Responses other than
+// 200 OK and 304 Not Modified are returned as errors.
+func (cs *ConfigService) download(rawURL string, header http.Header, limit int64) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", "brb")
+	resp, err := cs.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return resp, body, nil
+}
+
+// subscriptionDue reports whether a rule pack should be checked for a new version
+func subscriptionDue(subscription Subscription, state subscriptionState, now time.Time) bool {
+	if state.CheckedAt.IsZero() {
+		return true
+	}
+	refresh := defaultSubscriptionRefresh
+	if subscription.RefreshMinutes > 0 {
+		refresh = time.Duration(subscription.RefreshMinutes) * time.Minute
+	}
+	if state.Error != "" {
+		refresh = min(refresh, subscriptionRetry)
+	}
+	return !now.Before(state.CheckedAt.Add(refresh))
+}
+
+// validateSubscription checks the settings of a subscription
+func validateSubscription(subscription Subscription, report func(field, pattern string, err error)) {
+	if parsed, err := url.Parse(subscription.URL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		report("url", subscription.URL, errors.New("must be an https:// URL"))
+	}
+	if subscription.RefreshMinutes < 0 {
+		report("refreshMinutes", "", errors.New("must not be negative"))
+	}
+	if sum, err := hex.DecodeString(subscription.SHA256); subscription.SHA256 != "" && (err != nil || len(sum) != sha256.Size) {
+		report("sha256", subscription.SHA256, errors.New("must be 64 hexadecimal digits"))
+	}
+	if key, err := base64.StdEncoding.DecodeString(subscription.PublicKey); subscription.PublicKey != "" && (err != nil || len(key) != ed25519.PublicKeySize) {
+		report("publicKey", subscription.PublicKey, errors.New("must be a base64 Ed25519 public key"))
+	}
+	if subscription.SignatureURL != "" && subscription.PublicKey == "" {
+		report("signatureURL", subscription.SignatureURL, errors.New("needs a publicKey to check the signature with"))
+	}
+}
+
+// subscriptionCacheDir returns the directory rule packs are cached in, next to the config file
+func subscriptionCacheDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "subscriptions")
+}
+
+// subscriptionFile returns the cache file of a rule pack, named after a hash of its URL
+func subscriptionFile(cacheDir string, rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// subscriptionStateFile returns the file the sync state of a cached pack is kept in
+func subscriptionStateFile(file string) string {
+	return strings.TrimSuffix(file, ".json") + ".state.json"
+}
+
+// readSubscriptionState reads the sync state of a cached pack; a missing or unreadable state is empty
+func readSubscriptionState(file string) subscriptionState {
+	var state subscriptionState
+	if data, err := os.ReadFile(subscriptionStateFile(file)); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// writeSubscriptionState saves the sync state of a cached pack
+func writeSubscriptionState(file string, state subscriptionState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(subscriptionStateFile(file), data)
+}
+
+// writeFileAtomic replaces a file in one step, so a crash never leaves half a file behind.
+// A symlink is followed, and the file keeps its permissions; new files get 0644.
+func writeFileAtomic(path string, data []byte) error {
+	// Replace the target of a symlink, such as a config file kept with other dotfiles, not the link
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxUnwrapDepth bounds how many nested wrappers are removed from one URL
+const maxUnwrapDepth = 5
+
+// URLUnwrapper extracts the real destination from a redirector or safe-link URL
+type URLUnwrapper interface {
+	Unwrap(u *url.URL) (string, bool)
+}
+
+// QueryParamUnwrapper unwraps redirectors that carry the destination in a query parameter
+type QueryParamUnwrapper struct {
+	Hosts      []string // Exact hosts, "*.example.com" for subdomains, or "google.*" for any public suffix
+	PathPrefix string   // Optional path prefix the wrapper URL must have
+	Params     []string // Query parameters that may hold the destination, tried in order
+}
+
+// Unwrap returns the destination held in the first non-empty parameter
+func (q QueryParamUnwrapper) Unwrap(u *url.URL) (string, bool) {
+	if !wrapperHostMatches(q.Hosts, normalizeHost(u.Hostname())) {
+		return "", false
+	}
+	if q.PathPrefix != "" && !strings.HasPrefix(u.Path, q.PathPrefix) {
+		return "", false
+	}
+	query := u.Query()
+	for _, param := range q.Params {
+		if target := query.Get(param); isWebURL(target) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// AMPCacheUnwrapper unwraps AMP cache URLs such as
+// https://example-com.cdn.ampproject.org/c/s/example.com/article and https://www.google.com/amp/s/example.com/article
+type AMPCacheUnwrapper struct{}
+
+// Unwrap rebuilds the original URL from the path of an AMP cache URL
+func (AMPCacheUnwrapper) Unwrap(u *url.URL) (string, bool) {
+	host := normalizeHost(u.Hostname())
+	var rest string
+	switch {
+	case strings.HasSuffix(host, ".cdn.ampproject.org") || host == "cdn.ampproject.org":
+		// Content type prefix: /c/ (document), /v/ (viewer), /i/ (image)
+		if len(u.Path) < 3 || u.Path[0] != '/' || u.Path[2] != '/' || !strings.ContainsRune("cvi", rune(u.Path[1])) {
+			return "", false
+		}
+		rest = u.Path[3:]
+	case wrapperHostMatches([]string{"google.*", "www.google.*"}, host) && strings.HasPrefix(u.Path, "/amp/"):
+		rest = strings.TrimPrefix(u.Path, "/amp/")
+	default:
+		return "", false
+	}
+	scheme := "http://"
+	if after, ok := strings.CutPrefix(rest, "s/"); ok {
+		scheme = "https://"
+		rest = after
+	}
+	if rest == "" {
+		return "", false
+	}
+	target := scheme + rest
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	if !isWebURL(target) {
+		return "", false
+	}
+	return target, true
+}
+
+// builtinUnwrappers are the redirectors recognized without any configuration
+var builtinUnwrappers = []URLUnwrapper{
+	QueryParamUnwrapper{Hosts: []string{"*.safelinks.protection.outlook.com"}, Params: []string{"url"}},
+	QueryParamUnwrapper{Hosts: []string{"google.*", "www.google.*"}, PathPrefix: "/url", Params: []string{"q", "url"}},
+	QueryParamUnwrapper{Hosts: []string{"slack-redir.net"}, PathPrefix: "/link", Params: []string{"url"}},
+	QueryParamUnwrapper{Hosts: []string{"www.linkedin.com", "linkedin.com"}, PathPrefix: "/redir/redirect", Params: []string{"url"}},
+	QueryParamUnwrapper{Hosts: []string{"www.linkedin.com", "linkedin.com"}, PathPrefix: "/safety/go", Params: []string{"url"}},
+	QueryParamUnwrapper{Hosts: []string{"l.facebook.com", "lm.facebook.com", "l.messenger.com"}, PathPrefix: "/l.php", Params: []string{"u"}},
+	AMPCacheUnwrapper{},
+}
+
+// UnwrapService removes redirector and safe-link wrappers so rules see the real destination
+type UnwrapService struct {
+	unwrappers []URLUnwrapper
+	lock       sync.RWMutex
+}
+
+// NewUnwrapService creates a new UnwrapService with the built-in unwrappers and the configured wrappers
+func NewUnwrapService(wrappers []WrapperRule) *UnwrapService {
+	us := &UnwrapService{}
+	us.UpdateWrappers(wrappers)
+	return us
+}
+
+// NewUnwrapServiceWithUnwrappers creates a new UnwrapService with only the given unwrappers (for testing)
+func NewUnwrapServiceWithUnwrappers(unwrappers ...URLUnwrapper) *UnwrapService {
+	return &UnwrapService{
+		unwrappers: unwrappers,
+	}
+}
+
+// UpdateWrappers replaces the configured wrappers; the built-in unwrappers are always kept
+func (us *UnwrapService) UpdateWrappers(wrappers []WrapperRule) {
+	unwrappers := append([]URLUnwrapper{}, builtinUnwrappers...)
+	for _, wrapper := range wrappers {
+		unwrappers = append(unwrappers, QueryParamUnwrapper{
+			Hosts:      []string{wrapper.Host},
+			PathPrefix: wrapper.Path,
+			Params:     []string{wrapper.Param},
+		})
+	}
+	us.lock.Lock()
+	us.unwrappers = unwrappers
+	us.lock.Unlock()
+}
+
+// Name returns the name of this stage in the URL pipeline
+func (us *UnwrapService) Name() string {
+	return "unwrap"
+}
+
+// Process unwraps the URL, implementing URLStage
+func (us *UnwrapService) Process(rawURL string) (string, error) {
+	return us.Unwrap(rawURL), nil
+}
+
+// Unwrap removes wrappers until the URL is no longer wrapped, up to maxUnwrapDepth levels
+func (us *UnwrapService) Unwrap(rawURL string) string {
+	us.lock.RLock()
+	unwrappers := us.unwrappers
+	us.lock.RUnlock()
+
+	current := rawURL
+	for depth := 0; depth < maxUnwrapDepth; depth++ {
+		parsed, err := url.Parse(strings.TrimSpace(current))
+		if err != nil {
+			return current
+		}
+		next, ok := unwrapOnce(unwrappers, parsed)
+		if !ok || next == current {
+			return current
+		}
+		current = next
+	}
+	return current
+}
+
+// unwrapOnce applies the first unwrapper that recognizes the URL
+func unwrapOnce(unwrappers []URLUnwrapper, u *url.URL) (string, bool) {
+	for _, unwrapper := range unwrappers {
+		if target, ok := unwrapper.Unwrap(u); ok {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// wrapperHostMatches matches hosts like hostMatches, and "google.*" against any public suffix
+func wrapperHostMatches(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = normalizeHost(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+			suffix, found := strings.CutPrefix(host, prefix+".")
+			if found && suffix != "" {
+				if ps, _ := publicsuffix.PublicSuffix(host); ps == suffix {
+					return true
+				}
+			}
+			continue
+		}
+		if hostMatches(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWebURL reports whether s is an absolute http or https URL with a host
+func isWebURL(s string) bool {
+	parsed, err := url.Parse(s)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	return scheme == "http" || scheme == "https"
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// defaultPorts maps schemes to the port used when the URL does not specify one
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+	"ftp":   21,
+}
+
+// compiledMatcher is a URLMatcher with its host normalized and its port range and path glob parsed
+type compiledMatcher struct {
+	source     URLMatcher
+	scheme     string
+	host       string
+	domain     string
+	hasPort    bool
+	portLow    int
+	portHigh   int
+	pathPrefix string
+	pathGlob   *regexp.Regexp
+	query      map[string]string
+	spec       specificity
+}
+
+// compileMatcher validates a URLMatcher and prepares it for matching
+func compileMatcher(m URLMatcher) (compiledMatcher, error) {
+	c := compiledMatcher{
+		source: m,
+		scheme: strings.ToLower(m.Scheme),
+		host:   canonicalHostPattern(m.Host),
+		domain: canonicalHost(m.Domain),
+		query:  m.Query,
+		spec:   matcherSpecificity(m),
+	}
+	if strings.Contains(strings.TrimPrefix(c.host, "*."), "*") {
+		return compiledMatcher{}, fmt.Errorf("host %q: a wildcard is only allowed as a leading \"*.\"", m.Host)
+	}
+	if c.domain != "" {
+		registrable, err := publicsuffix.EffectiveTLDPlusOne(c.domain)
+		if err != nil {
+			return compiledMatcher{}, fmt.Errorf("domain %q is not a registrable domain", m.Domain)
+		}
+		if registrable != c.domain {
+			return compiledMatcher{}, fmt.Errorf("domain %q is not a registrable domain (did you mean %q?)", m.Domain, registrable)
+		}
+	}
+	if m.Port != "" {
+		low, high, ok := parsePortRange(m.Port)
+		if !ok {
+			return compiledMatcher{}, fmt.Errorf("port %q: expected a port or a range like \"8000-8999\"", m.Port)
+		}
+		c.hasPort, c.portLow, c.portHigh = true, low, high
+	}
+	if isGlob(m.Path) {
+		glob, err := regexp.Compile(globToRegex(m.Path))
+		if err != nil {
+			return compiledMatcher{}, fmt.Errorf("path %q: %w", m.Path, err)
+		}
+		c.pathGlob = glob
+	} else {
+		c.pathPrefix = m.Path
+	}
+	return c, nil
+}
+
+// matches reports whether every constraint of the matcher holds for the parsed URL
+func (m compiledMatcher) matches(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+	if m.scheme != "" && m.scheme != strings.ToLower(u.Scheme) {
+		return false
+	}
+	host := normalizeHost(u.Hostname())
+	if m.host != "" && !hostMatches(m.host, host) {
+		return false
+	}
+	if m.domain != "" && !domainMatches(m.domain, host) {
+		return false
+	}
+	if m.hasPort {
+		port, ok := effectivePort(u)
+		if !ok || port < m.portLow || port > m.portHigh {
+			return false
+		}
+	}
+	if m.pathGlob != nil && !m.pathGlob.MatchString(urlPath(u)) {
+		return false
+	}
+	if m.pathPrefix != "" && !strings.HasPrefix(urlPath(u), m.pathPrefix) {
+		return false
+	}
+	if len(m.query) > 0 && !queryMatches(m.query, u.Query()) {
+		return false
+	}
+	return true
+}
+
+// normalizeHost lowercases a host and drops the trailing dot of a fully qualified name
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// hostMatches matches an exact host or a "*.example.com" wildcard (subdomains only)
+func hostMatches(pattern, host string) bool {
+	pattern = normalizeHost(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// domainMatches reports whether the registrable domain (eTLD+1) of host equals domain
+func domainMatches(domain, host string) bool {
+	if host == "" {
+		return false
+	}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return false
+	}
+	return registrable == normalizeHost(domain)
+}
+
+// effectivePort returns the explicit port of the URL, or the default port for its scheme
+func effectivePort(u *url.URL) (int, bool) {
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		return port, err == nil
+	}
+	port, ok := defaultPorts[strings.ToLower(u.Scheme)]
+	return port, ok
+}
+
+// parsePortRange parses a single port or an inclusive "low-high" range
+func parsePortRange(spec string) (int, int, bool) {
+	lowStr, highStr, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+	low, err := strconv.Atoi(strings.TrimSpace(lowStr))
+	if err != nil {
+		return 0, 0, false
+	}
+	high := low
+	if isRange {
+		if high, err = strconv.Atoi(strings.TrimSpace(highStr)); err != nil {
+			return 0, 0, false
+		}
+	}
+	if low < 0 || high > 65535 || low > high {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// urlPath returns the path of the URL, treating an empty path as "/"
+func urlPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// isGlob reports whether a path pattern uses glob syntax instead of a plain prefix
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globToRegex converts a path glob into an anchored regular expression where * also spans "/"
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	inClass := false
+	for _, r := range glob {
+		switch {
+		case inClass:
+			if r == ']' {
+				inClass = false
+			}
+			b.WriteRune(r)
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteString(".")
+		case r == '[':
+			inClass = true
+			b.WriteRune(r)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// queryMatches requires every key to be present and, when a value is given, to carry that value
+func queryMatches(required map[string]string, values url.Values) bool {
+	for key, want := range required {
+		got, ok := values[key]
+		if !ok {
+			return false
+		}
+		if want != "" && !slices.Contains(got, want) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"log"
+)
+
+// URLStage transforms a URL before it is matched against browser rules
+type URLStage interface {
+	Name() string
+	Process(rawURL string) (string, error)
+}
+
+// URLStageResult records what a single stage did to a URL
+type URLStageResult struct {
+	Stage  string
+	Input  string
+	Output string
+	Err    error
+}
+
+// Changed reports whether the stage produced a different URL
+func (r URLStageResult) Changed() bool {
+	return r.Err == nil && r.Input != r.Output
+}
+
+// URLPipeline runs URL stages in order before matching
+type URLPipeline struct {
+	stages []URLStage
+}
+
+// NewURLPipeline creates a new URLPipeline with the given stages
+func NewURLPipeline(stages ...URLStage) *URLPipeline {
+	return &URLPipeline{
+		stages: stages,
+	}
+}
+
+// Process runs every stage in order and returns the final URL.
+// A stage that fails is logged and skipped, so the next stage receives its input unchanged.
+func (p *URLPipeline) Process(rawURL string) (string, []URLStageResult) {
+	current := rawURL
+	var results []URLStageResult
+	for _, stage := range p.stages {
+		output, err := stage.Process(current)
+		result := URLStageResult{
+			Stage:  stage.Name(),
+			Input:  current,
+			Output: output,
+			Err:    err,
+		}
+		if err != nil {
+			log.Printf("URL stage %s failed for %s: %v", stage.Name(), current, err)
+			result.Output = current
+		}
+		results = append(results, result)
+		current = result.Output
+	}
+	return current, results
+}
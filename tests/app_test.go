@@ -62,3 +62,31 @@ func TestApp_HandleURL_DefaultBrowserFallback(t *testing.T) {
 	browser := patternService.FindBrowserForURL(testURL)
 	assert.Empty(t, browser, "Expected no match for non-matching URL")
 }
+
+func TestApp_HandleURL_RewrittenURLIsOpened(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:   []services.URLMatcher{{Host: "portal.example.com"}},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+		},
+		Rewrites: []services.RewriteRule{
+			{Find: `^https?://intranet\.old\.example\.com/`, Replace: "https://portal.example.com/"},
+		},
+	}
+
+	pipeline := services.NewURLPipeline(services.NewRewriteService(testConfig.Rewrites))
+	patternService := services.NewPatternService(testConfig)
+	mockOpener := new(MockBrowserOpener)
+	browserService := services.NewBrowserServiceWithOpener(mockOpener)
+
+	mockOpener.On("OpenBrowser", "/Applications/Chrome.app", "https://portal.example.com/wiki").Return()
+
+	// Rewrites run before matching, and the rewritten URL is what gets opened
+	rewritten, _ := pipeline.Process("http://intranet.old.example.com/wiki")
+	browserPath := patternService.FindBrowserForURL(rewritten)
+	browserService.OpenBrowser(browserPath, rewritten)
+
+	mockOpener.AssertExpectations(t)
+}
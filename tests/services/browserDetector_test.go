@@ -0,0 +1,113 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const profilesTestdata = "testdata/profiles"
+
+func TestReadChromiumProfiles(t *testing.T) {
+	profiles, err := services.ReadChromiumProfiles(filepath.Join(profilesTestdata, "Google", "Chrome"))
+	if err != nil {
+		t.Fatalf("ReadChromiumProfiles failed: %v", err)
+	}
+
+	expected := []services.BrowserProfile{
+		{ID: "Profile 1", Name: "Work", Directory: "Profile 1", Default: true},
+		{ID: "Default", Name: "Personal", Directory: "Default"},
+		{ID: "Profile 2", Name: "Testing", Directory: "Profile 2"},
+		{ID: "Profile 3", Name: "Profile 3", Directory: "Profile 3"},
+	}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("ReadChromiumProfiles() = %+v, want %+v", profiles, expected)
+	}
+}
+
+func TestReadFirefoxProfiles(t *testing.T) {
+	profiles, err := services.ReadFirefoxProfiles(filepath.Join(profilesTestdata, "Firefox"))
+	if err != nil {
+		t.Fatalf("ReadFirefoxProfiles failed: %v", err)
+	}
+
+	expected := []services.BrowserProfile{
+		{ID: "work", Name: "work", Directory: "Profiles/abcd1234.work", Default: true},
+		{ID: "default-release", Name: "default-release", Directory: "Profiles/wxyz9876.default-release"},
+	}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("ReadFirefoxProfiles() = %+v, want %+v", profiles, expected)
+	}
+}
+
+func TestReadBrowserProfiles_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := services.ReadChromiumProfiles(dir); !os.IsNotExist(err) {
+		t.Errorf("missing Local State should be reported as not existing, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Local State"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.ReadChromiumProfiles(dir); err == nil {
+		t.Errorf("invalid Local State should fail")
+	}
+	if profiles, err := services.ReadBrowserProfiles(services.BrowserFamilyOther, dir); profiles != nil || err != nil {
+		t.Errorf("other browsers have no profiles, got %v, %v", profiles, err)
+	}
+}
+
+func TestBrowserDetector_DetectBrowsers_Profiles(t *testing.T) {
+	appsDir := t.TempDir()
+	for _, app := range []string{"Safari.app", "Google Chrome.app", "Firefox.app", "Vivaldi.app"} {
+		if err := os.Mkdir(filepath.Join(appsDir, app), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	detector := services.NewBrowserDetectorWithPaths([]string{appsDir}, profilesTestdata)
+	browsers := detector.DetectBrowsers()
+
+	profileCounts := map[string]int{"Safari": 0, "Google Chrome": 4, "Firefox": 2, "Vivaldi": 0}
+	if len(browsers) != len(profileCounts) {
+		t.Fatalf("expected %d browsers, got %+v", len(profileCounts), browsers)
+	}
+	for _, browser := range browsers {
+		if count, ok := profileCounts[browser.Name]; !ok || len(browser.Profiles) != count {
+			t.Errorf("%s: expected %d profiles, got %+v", browser.Name, count, browser.Profiles)
+		}
+	}
+}
+
+func TestBrowserDetector_DetectBrowsers_ShortNames(t *testing.T) {
+	appsDir := t.TempDir()
+	supportDir := t.TempDir()
+	localState, err := os.ReadFile(filepath.Join(profilesTestdata, "Google", "Chrome", "Local State"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range []string{"Edge.app", "Edge Beta.app", "Chrome.app", "Chrome Canary.app"} {
+		if err := os.Mkdir(filepath.Join(appsDir, app), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dataDir := range []string{"Microsoft Edge", "Microsoft Edge Beta", "Google/Chrome", "Google/Chrome Canary"} {
+		if err := os.MkdirAll(filepath.Join(supportDir, dataDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(supportDir, dataDir, "Local State"), localState, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	browsers := services.NewBrowserDetectorWithPaths([]string{appsDir}, supportDir).DetectBrowsers()
+	if len(browsers) != 4 {
+		t.Fatalf("expected 4 browsers, got %+v", browsers)
+	}
+	for _, browser := range browsers {
+		if len(browser.Profiles) != 4 {
+			t.Errorf("%s: expected 4 profiles, got %+v", browser.Name, browser.Profiles)
+		}
+	}
+}
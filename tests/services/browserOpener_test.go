@@ -2,6 +2,7 @@ package services
 
 import (
 	"browserRedirectBar/src/services"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/mock"
@@ -37,3 +38,160 @@ func TestBrowserService_OpenBrowser_NilOpener(t *testing.T) {
 	// For now, test that it doesn't panic
 	service.OpenBrowser("/Applications/Chrome.app", "https://example.com")
 }
+
+// MockOptionsOpener is a mock for LaunchOptionsOpener
+type MockOptionsOpener struct {
+	MockBrowserOpener
+}
+
+// LaunchBrowser implements LaunchOptionsOpener interface
+func (m *MockOptionsOpener) LaunchBrowser(browserPath string, url string, opts services.LaunchOptions) error {
+	return m.Called(browserPath, url, opts).Error(0)
+}
+
+func TestBrowserService_OpenBrowserWithOptions(t *testing.T) {
+	opts := services.LaunchOptions{Profile: "Profile 1"}
+
+	optionsOpener := new(MockOptionsOpener)
+	optionsOpener.On("LaunchBrowser", "/Applications/Google Chrome.app", "https://example.com", opts).Return(nil)
+	optionsOpener.On("LaunchBrowser", "/Applications/Firefox.app", "https://example.com", opts).Return(errors.New("no such profile"))
+	optionsOpener.On("OpenBrowser", "/Applications/Firefox.app", "https://example.com").Return()
+	optionsOpener.On("OpenBrowser", "/Applications/Google Chrome.app", "https://example.org").Return()
+	service := services.NewBrowserServiceWithOpener(optionsOpener)
+	service.OpenBrowserWithOptions("/Applications/Google Chrome.app", "https://example.com", opts)
+	service.OpenBrowserWithOptions("/Applications/Firefox.app", "https://example.com", opts)
+	service.OpenBrowserWithOptions("/Applications/Google Chrome.app", "https://example.org", services.LaunchOptions{})
+	optionsOpener.AssertExpectations(t)
+
+	// Openers without options support still open the URL
+	plainOpener := new(MockBrowserOpener)
+	plainOpener.On("OpenBrowser", "/Applications/Google Chrome.app", "https://example.com").Return()
+	services.NewBrowserServiceWithOpener(plainOpener).OpenBrowserWithOptions("/Applications/Google Chrome.app", "https://example.com", opts)
+	plainOpener.AssertExpectations(t)
+}
+
+func TestBrowserService_OpenBrowsers(t *testing.T) {
+	const url = "https://staging.example.dev/"
+	opts := launchOptions("", services.LaunchConfig{NewWindow: true})
+	browsers := []string{"/Applications/Google Chrome.app", "/Applications/Firefox.app", "/Applications/Safari.app", "/Applications/Missing.app"}
+
+	opener := new(MockOptionsOpener)
+	opener.On("LaunchBrowser", browsers[0], url, opts).Return(nil)
+	opener.On("LaunchBrowser", browsers[1], url, opts).Return(nil)
+	// Safari has no new-window flag; it retries without the options
+	opener.On("LaunchBrowser", browsers[2], url, opts).Return(errors.New("exit status 1"))
+	opener.On("LaunchBrowser", browsers[2], url, services.LaunchOptions{}).Return(nil)
+	opener.On("LaunchBrowser", browsers[3], url, opts).Return(errors.New("exit status 1"))
+	opener.On("LaunchBrowser", browsers[3], url, services.LaunchOptions{}).Return(errors.New("unable to find application"))
+
+	results := services.NewBrowserServiceWithOpener(opener).OpenBrowsers(browsers, url, opts)
+
+	if len(results) != len(browsers) {
+		t.Fatalf("expected a result per browser, got %+v", results)
+	}
+	for i, result := range results {
+		if result.BrowserPath != browsers[i] {
+			t.Errorf("result %d is for %q, want %q", i, result.BrowserPath, browsers[i])
+		}
+		if failed := result.Err != nil; failed != (i == 3) {
+			t.Errorf("%s: unexpected error %v", result.BrowserPath, result.Err)
+		}
+	}
+	opener.AssertNotCalled(t, "OpenBrowser", mock.Anything, mock.Anything)
+	opener.AssertExpectations(t)
+}
+
+func TestBuildLaunchArgs(t *testing.T) {
+	const url = "https://example.com"
+	tests := []struct {
+		name     string
+		browser  string
+		opts     services.LaunchOptions
+		expected []string
+		ignored  []string
+	}{
+		{"No options", "/Applications/Google Chrome.app", services.LaunchOptions{}, []string{"-a", "/Applications/Google Chrome.app", url}, nil},
+		{"Chrome profile", "/Applications/Google Chrome.app", services.LaunchOptions{Profile: "Profile 1"}, []string{"-n", "-a", "/Applications/Google Chrome.app", "--args", "--profile-directory=Profile 1", url}, nil},
+		{"Edge profile", "/Applications/Microsoft Edge.app/", services.LaunchOptions{Profile: "Default"}, []string{"-n", "-a", "/Applications/Microsoft Edge.app/", "--args", "--profile-directory=Default", url}, nil},
+		{"Brave profile", "/Users/me/Applications/Brave Browser.app", services.LaunchOptions{Profile: "Profile 2"}, []string{"-n", "-a", "/Users/me/Applications/Brave Browser.app", "--args", "--profile-directory=Profile 2", url}, nil},
+		{"Firefox profile", "/Applications/Firefox.app", services.LaunchOptions{Profile: "work"}, []string{"-n", "-a", "/Applications/Firefox.app", "--args", "-P", "work", "--new-tab", url}, nil},
+		{"Firefox Developer Edition profile", "/Applications/Firefox Developer Edition.app", services.LaunchOptions{Profile: "dev-edition-default"}, []string{"-n", "-a", "/Applications/Firefox Developer Edition.app", "--args", "-P", "dev-edition-default", "--new-tab", url}, nil},
+		{"Chrome incognito in a profile", "/Applications/Google Chrome.app", launchOptions("Profile 1", services.LaunchConfig{Private: true}), []string{"-n", "-a", "/Applications/Google Chrome.app", "--args", "--profile-directory=Profile 1", "--incognito", url}, nil},
+		{"Edge InPrivate", "/Applications/Microsoft Edge.app", launchOptions("", services.LaunchConfig{Private: true}), []string{"-n", "-a", "/Applications/Microsoft Edge.app", "--args", "--inprivate", url}, nil},
+		{"Edge.app InPrivate in a profile", "/Applications/Edge.app", launchOptions("Profile 1", services.LaunchConfig{Private: true}), []string{"-n", "-a", "/Applications/Edge.app", "--args", "--profile-directory=Profile 1", "--inprivate", url}, nil},
+		{"Edge Canary InPrivate", "/Applications/Edge Canary.app", launchOptions("", services.LaunchConfig{Private: true}), []string{"-n", "-a", "/Applications/Edge Canary.app", "--args", "--inprivate", url}, nil},
+		{"Chrome.app incognito in a profile", "/Applications/Chrome.app", launchOptions("Default", services.LaunchConfig{Private: true}), []string{"-n", "-a", "/Applications/Chrome.app", "--args", "--profile-directory=Default", "--incognito", url}, nil},
+		{"Chrome Beta profile", "/Applications/Chrome Beta.app", services.LaunchOptions{Profile: "Profile 2"}, []string{"-n", "-a", "/Applications/Chrome Beta.app", "--args", "--profile-directory=Profile 2", url}, nil},
+		{"Chrome new window", "/Applications/Google Chrome.app", launchOptions("", services.LaunchConfig{NewWindow: true}), []string{"-n", "-a", "/Applications/Google Chrome.app", "--args", "--new-window", url}, nil},
+		{"Chrome app window", "/Applications/Google Chrome.app", launchOptions("Profile 1", services.LaunchConfig{App: true}), []string{"-n", "-a", "/Applications/Google Chrome.app", "--args", "--profile-directory=Profile 1", "--app=" + url}, nil},
+		{"Chrome in the background", "/Applications/Google Chrome.app", launchOptions("", services.LaunchConfig{Background: true}), []string{"-g", "-a", "/Applications/Google Chrome.app", url}, nil},
+		{"Firefox private window", "/Applications/Firefox.app", launchOptions("work", services.LaunchConfig{Private: true, Background: true}), []string{"-g", "-n", "-a", "/Applications/Firefox.app", "--args", "-P", "work", "--private-window", url}, nil},
+		{"Firefox new window", "/Applications/Firefox.app", launchOptions("", services.LaunchConfig{NewWindow: true}), []string{"-n", "-a", "/Applications/Firefox.app", "--args", "--new-window", url}, nil},
+		{"Firefox has no app windows", "/Applications/Firefox.app", launchOptions("", services.LaunchConfig{App: true}), []string{"-a", "/Applications/Firefox.app", url}, []string{"app window"}},
+		{"Safari only supports background", "/Applications/Safari.app", launchOptions("Work", services.LaunchConfig{Private: true, Background: true}), []string{"-g", "-a", "/Applications/Safari.app", url}, []string{"profile", "private window"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ignored := services.BuildLaunchArgs(tt.browser, url, tt.opts)
+			if !stringsEqual(result, tt.expected) {
+				t.Errorf("BuildLaunchArgs(%q, %+v) = %q, want %q", tt.browser, tt.opts, result, tt.expected)
+			}
+			if !stringsEqual(ignored, tt.ignored) {
+				t.Errorf("ignored options = %q, want %q", ignored, tt.ignored)
+			}
+		})
+	}
+}
+
+// launchOptions combines a profile and a launch block
+func launchOptions(profile string, launch services.LaunchConfig) services.LaunchOptions {
+	return services.NewLaunchOptions(profile, &launch)
+}
+
+func TestPatternService_LaunchOptions(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"github.com"}, BrowserURL: "/Applications/Firefox.app"},
+			{Patterns: []string{"bank.example"}, BrowserURL: "/Applications/Firefox.app", Profile: "private", Launch: &services.LaunchConfig{Private: true}},
+		},
+		DefaultBrowserURL:     "/Applications/Google Chrome.app",
+		DefaultBrowserProfile: "Profile 1",
+		DefaultLaunch:         &services.LaunchConfig{Background: true},
+	})
+
+	tests := []struct {
+		url      string
+		expected services.LaunchOptions
+	}{
+		{"https://example.com/", launchOptions("Profile 1", services.LaunchConfig{Background: true})},
+		{"https://github.com/", services.LaunchOptions{}},
+		{"https://bank.example/", launchOptions("private", services.LaunchConfig{Private: true})},
+	}
+	for _, tt := range tests {
+		if decision := service.Resolve(services.URLRequest{URL: tt.url}); decision.Launch != tt.expected {
+			t.Errorf("%s: launch options %+v, want %+v", tt.url, decision.Launch, tt.expected)
+		}
+	}
+}
+
+func TestPatternService_OpenInAllBrowsers(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"staging.example.dev"}, BrowserURL: "/Applications/Google Chrome.app", BrowserURLs: []string{"/Applications/Firefox.app", "/Applications/Google Chrome.app", "/Applications/Safari.app"}, Open: services.OpenAll},
+			{Patterns: []string{"preview.example.dev"}, BrowserURLs: []string{"/Applications/Firefox.app", "/Applications/Safari.app"}},
+		},
+	})
+
+	all := service.Resolve(services.URLRequest{URL: "https://staging.example.dev/"})
+	if !stringsEqual(all.BrowserURLs, []string{"/Applications/Google Chrome.app", "/Applications/Firefox.app", "/Applications/Safari.app"}) || all.BrowserURL != "/Applications/Google Chrome.app" {
+		t.Errorf("open all should list every browser once, got %q / %q", all.BrowserURL, all.BrowserURLs)
+	}
+	first := service.Resolve(services.URLRequest{URL: "https://preview.example.dev/"})
+	if first.BrowserURLs != nil || first.BrowserURL != "/Applications/Firefox.app" {
+		t.Errorf("open first should use the first browser, got %q / %q", first.BrowserURL, first.BrowserURLs)
+	}
+	if browser := service.FindBrowserForURL("https://preview.example.dev/"); browser != "/Applications/Firefox.app" {
+		t.Errorf("FindBrowserForURL = %q", browser)
+	}
+}
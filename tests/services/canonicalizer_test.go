@@ -0,0 +1,130 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"testing"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Mixed-case scheme and host", "HTTPS://GitHub.COM/Org/Repo", "https://github.com/Org/Repo"},
+		{"Default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"Default http port and empty path", "http://example.com:80", "http://example.com/"},
+		{"Other ports are kept", "https://example.com:8443/", "https://example.com:8443/"},
+		{"Default port of another scheme is kept", "http://example.com:443/", "http://example.com:443/"},
+		{"Trailing dot", "https://example.com./x", "https://example.com/x"},
+		{"Unicode IDN to punycode", "https://münchen.de/", "https://xn--mnchen-3ya.de/"},
+		{"Upper-case punycode", "https://WWW.XN--MNCHEN-3YA.DE", "https://www.xn--mnchen-3ya.de/"},
+		{"Full-width host", "https://ｅｘａｍｐｌｅ.com/", "https://example.com/"},
+		{"Escaped unreserved characters are decoded", "https://example.com/%7euser/%41", "https://example.com/~user/A"},
+		{"Escapes use upper-case hex", "https://example.com/a%2fb?q=%e2%82%ac", "https://example.com/a%2Fb?q=%E2%82%AC"},
+		{"Raw Unicode in path and query is escaped", "https://example.com/café?q=ü", "https://example.com/caf%C3%A9?q=%C3%BC"},
+		{"Surrounding and embedded whitespace", "  https://example.com/a\n/b c\t ", "https://example.com/a/b%20c"},
+		{"Whitespace inside the host", "https://exa\tmple.com/", "https://example.com/"},
+		{"Userinfo is kept", "https://user@Example.com/", "https://user@example.com/"},
+		{"IPv6 literal with default port", "https://[::1]:443/", "https://[::1]/"},
+		{"Host that is not valid IDNA is only lowercased", "https://My_Host.Example.com/", "https://my_host.example.com/"},
+		{"Fragment is normalized", "https://example.com/#%7esection", "https://example.com/#~section"},
+		{"Opaque URL keeps its case", "MAILTO:Someone@Example.com", "mailto:Someone@Example.com"},
+		{"Already canonical", "https://example.com/path?a=1&b=2", "https://example.com/path?a=1&b=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := services.CanonicalizeURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("CanonicalizeURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+			if again := services.CanonicalizeURL(result); again != result {
+				t.Errorf("canonical form is not stable: %q became %q", result, again)
+			}
+		})
+	}
+}
+
+func TestPatternService_MatchesCanonicalURL(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"münchen.de"}, BrowserURL: "/Applications/Unicode Pattern.app"},
+			{Patterns: []string{"xn--bcher-kva.example"}, BrowserURL: "/Applications/Punycode Pattern.app"},
+			{Matchers: []services.URLMatcher{{Domain: "zürich.ch"}}, BrowserURL: "/Applications/Unicode Domain.app"},
+			{RegexPatterns: []string{`^https://github\.com/`}, BrowserURL: "/Applications/Chrome.app"},
+			{Matchers: []services.URLMatcher{{Host: "wiki.example.org", Path: "/~team"}}, BrowserURL: "/Applications/Wiki.app"},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Unicode pattern, punycode URL", "https://www.xn--mnchen-3ya.de/", "/Applications/Unicode Pattern.app"},
+		{"Unicode pattern, upper-case Unicode URL", "https://MÜNCHEN.DE/", "/Applications/Unicode Pattern.app"},
+		{"Punycode pattern, Unicode URL", "https://bücher.example/", "/Applications/Punycode Pattern.app"},
+		{"Unicode domain matcher, punycode URL", "https://www.xn--zrich-kva.ch/", "/Applications/Unicode Domain.app"},
+		{"Regex with default port and trailing dot", "HTTPS://GitHub.com.:443/org", "/Applications/Chrome.app"},
+		{"Regex with embedded whitespace", " https://git\nhub.com/org ", "/Applications/Chrome.app"},
+		{"Escaped path", "https://wiki.example.org/%7Eteam/page", "/Applications/Wiki.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := service.FindBrowserForURL(tt.url); result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_RegexMatchesURLAsGiven(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{RegexPatterns: []string{`^https?://localhost:3000$`}, BrowserURL: "/Applications/Dev.app"},
+			{RegexPatterns: []string{`^https://example\.com:443/`}, BrowserURL: "/Applications/Port.app"},
+			{RegexPatterns: []string{`^https://GitHub\.com/MyOrg`}, BrowserURL: "/Applications/Chrome.app"},
+			{Patterns: []string{"shop.example.net:443"}, BrowserURL: "/Applications/Shop.app"},
+		},
+		DefaultBrowserURL: "/Applications/Safari.app",
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Anchored regex without a path", "http://localhost:3000", "/Applications/Dev.app"},
+		{"Anchored regex with the default port", "https://example.com:443/x", "/Applications/Port.app"},
+		{"Regex with a mixed-case host", "https://GitHub.com/MyOrg/repo", "/Applications/Chrome.app"},
+		{"Regex still matches the canonical form", "  https://example.com:443/x ", "/Applications/Port.app"},
+		{"Substring patterns only match the canonical form", "https://shop.example.net:443/", "/Applications/Safari.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resolved := service.Resolve(services.URLRequest{URL: tt.url}); resolved.BrowserURL != tt.expected {
+				t.Errorf("Resolve(%q) chose %q, want %q", tt.url, resolved.BrowserURL, tt.expected)
+			}
+			if explained := service.Explain(services.URLRequest{URL: tt.url}); explained.BrowserURL != tt.expected {
+				t.Errorf("Explain(%q) chose %q, want %q", tt.url, explained.BrowserURL, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_OpensOriginalURL(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{{Patterns: []string{"github.com/"}, BrowserURL: "/Applications/Chrome.app"}},
+	})
+
+	decision := service.Resolve(services.URLRequest{URL: "HTTPS://GitHub.com:443"})
+	if decision.BrowserURL != "/Applications/Chrome.app" {
+		t.Errorf("canonical URL should match, got %q", decision.BrowserURL)
+	}
+	if decision.MatchURL != "https://github.com/" || decision.OpenURL != "HTTPS://GitHub.com:443" {
+		t.Errorf("match URL %q / open URL %q; the opened URL should stay unchanged", decision.MatchURL, decision.OpenURL)
+	}
+}
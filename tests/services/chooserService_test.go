@@ -0,0 +1,145 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"testing"
+	"time"
+)
+
+// openedDecisions records the decisions a ChooserService opens
+type openedDecisions struct {
+	decisions []services.Decision
+}
+
+// open implements ChooserOpenFunc
+func (o *openedDecisions) open(decision services.Decision) {
+	o.decisions = append(o.decisions, decision)
+}
+
+func TestPatternService_Ask(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"github.com"}, BrowserURL: "/Applications/Firefox.app"},
+			{Patterns: []string{"docs.google.com"}, BrowserURL: "/Applications/Google Chrome.app", Ask: true},
+		},
+		DefaultBrowserURL: "/Applications/Safari.app",
+		AskUnmatched:      true,
+	})
+
+	tests := []struct {
+		url     string
+		ask     bool
+		browser string
+	}{
+		{"https://github.com/", false, "/Applications/Firefox.app"},
+		{"https://docs.google.com/document/d/1", true, "/Applications/Google Chrome.app"},
+		{"https://example.com/", true, "/Applications/Safari.app"},
+		{"mailto:someone@example.com", false, ""},
+	}
+	for _, tt := range tests {
+		decision := service.Resolve(services.URLRequest{URL: tt.url})
+		if decision.Ask != tt.ask || decision.BrowserURL != tt.browser {
+			t.Errorf("%s: ask %v with browser %q, want ask %v with %q", tt.url, decision.Ask, decision.BrowserURL, tt.ask, tt.browser)
+		}
+	}
+}
+
+func TestChooserService(t *testing.T) {
+	clock := &movableClock{now: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)}
+	opened := &openedDecisions{}
+	chooser := services.NewChooserService(30*time.Second, opened.open)
+	chooser.SetClock(clock)
+	changes := 0
+	chooser.SetOnChange(func() { changes++ })
+
+	decision := func(url string) services.Decision {
+		return services.Decision{
+			OpenURL:     url,
+			BrowserURL:  "/Applications/Google Chrome.app",
+			BrowserURLs: []string{"/Applications/Google Chrome.app", "/Applications/Firefox.app"},
+			Launch:      launchOptions("Profile 1", services.LaunchConfig{NewWindow: true}),
+			Ask:         true,
+		}
+	}
+	first := chooser.Park(decision("https://one.example/"))
+	clock.now = clock.now.Add(10 * time.Second)
+	second := chooser.Park(decision("https://two.example/"))
+	third := chooser.Park(decision("https://three.example/"))
+
+	if pending := chooser.Pending(); len(pending) != 3 || pending[0].ID != first.ID || pending[2].ID != third.ID {
+		t.Fatalf("expected three links in arrival order, got %+v", pending)
+	}
+	if changes != 3 {
+		t.Errorf("expected a change per parked link, got %d", changes)
+	}
+
+	// Choosing another browser opens only that browser, without the rule's profile
+	if err := chooser.Choose(second.ID, "/Applications/Firefox.app", ""); err != nil {
+		t.Fatalf("Choose failed: %v", err)
+	}
+	if err := chooser.Choose(second.ID, "/Applications/Firefox.app", ""); err == nil {
+		t.Errorf("a link can only be chosen once")
+	}
+	if err := chooser.Cancel(third.ID); err != nil {
+		t.Errorf("Cancel failed: %v", err)
+	}
+	if len(opened.decisions) != 1 {
+		t.Fatalf("expected only the chosen link to open, got %+v", opened.decisions)
+	}
+	chosen := opened.decisions[0]
+	if chosen.OpenURL != "https://two.example/" || chosen.BrowserURL != "/Applications/Firefox.app" || chosen.BrowserURLs != nil || chosen.Ask {
+		t.Errorf("unexpected chosen decision %+v", chosen)
+	}
+	if chosen.Launch != launchOptions("", services.LaunchConfig{NewWindow: true}) {
+		t.Errorf("launch options = %+v, want the rule's options without its profile", chosen.Launch)
+	}
+
+	// The first link times out 30 seconds after it was parked and opens as decided
+	clock.now = clock.now.Add(19 * time.Second)
+	if expired := chooser.Expire(); expired != 0 {
+		t.Errorf("no link should expire before its deadline, got %d", expired)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if expired := chooser.Expire(); expired != 1 {
+		t.Errorf("expected the first link to expire, got %d", expired)
+	}
+	timedOut := opened.decisions[len(opened.decisions)-1]
+	if timedOut.OpenURL != "https://one.example/" || len(timedOut.BrowserURLs) != 2 || timedOut.Launch.Profile != "Profile 1" || timedOut.Ask {
+		t.Errorf("a timed out link should open as decided, got %+v", timedOut)
+	}
+	if pending := chooser.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending links, got %+v", pending)
+	}
+	if changes != 6 {
+		t.Errorf("expected a change for the choice, the cancel and the timeout, got %d changes", changes)
+	}
+}
+
+func TestChooserService_Remember(t *testing.T) {
+	opened := &openedDecisions{}
+	chooser := services.NewChooserService(0, opened.open)
+	var learned []services.Decision
+	chooser.SetLearner(func(decision services.Decision) error {
+		learned = append(learned, decision)
+		return nil
+	})
+
+	remembered := chooser.Park(services.Decision{MatchURL: "https://docs.example.com/", BrowserURL: "/Applications/Safari.app", Ask: true})
+	once := chooser.Park(services.Decision{MatchURL: "https://one-off.example.org/", BrowserURL: "/Applications/Safari.app", Ask: true})
+	if err := chooser.SetRemember(remembered.ID, true); err != nil {
+		t.Fatalf("SetRemember failed: %v", err)
+	}
+	if err := chooser.SetRemember(42, true); err == nil {
+		t.Errorf("SetRemember should fail for an unknown link")
+	}
+
+	_ = chooser.Choose(once.ID, "/Applications/Firefox.app", "")
+	_ = chooser.Choose(remembered.ID, "/Applications/Google Chrome.app", "Profile 1")
+
+	if len(opened.decisions) != 2 {
+		t.Errorf("both links should open, got %d", len(opened.decisions))
+	}
+	if len(learned) != 1 || learned[0].MatchURL != "https://docs.example.com/" || learned[0].BrowserURL != "/Applications/Google Chrome.app" || learned[0].Launch.Profile != "Profile 1" {
+		t.Errorf("only the remembered choice should be learned, got %+v", learned)
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlConfig = `# Work links go to Chrome
+browsers:
+  - regexPatterns:
+      - ^https://(www\.)?github\.com/example/
+    browserURL: /Applications/Google Chrome.app
+    priority: 2
+defaultBrowserURL: /Applications/Safari.app
+include:
+  - team.toml
+`
+
+const tomlConfig = `defaultBrowserURL = "/Applications/Safari.app"
+include = ["team.toml"]
+
+[[browsers]]
+regexPatterns = ['^https://(www\.)?github\.com/example/']
+browserURL = "/Applications/Google Chrome.app"
+priority = 2
+`
+
+const tomlTeamRules = `[[browsers]]
+patterns = ["jira.example.com"]
+browserURL = "/Applications/Firefox.app"
+
+[shorteners]
+hosts = ["go.example.com"]
+maxHops = 3
+`
+
+func TestConfigService_Formats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "config.yaml", yamlConfig},
+		{"yml", "config.yml", yamlConfig},
+		{"toml", "config.toml", tomlConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, map[string]string{tt.file: tt.content, "team.toml": tomlTeamRules})
+			configPath := filepath.Join(dir, tt.file)
+			service, err := services.NewConfigServiceWithPath(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := service.Load(); err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+
+			patterns := services.NewPatternServiceWithRules(service.GetRules())
+			if got := patterns.FindBrowserForURL("https://github.com/example/repo"); got != "/Applications/Google Chrome.app" {
+				t.Errorf("regex from %s should match without double escaping, got %s", tt.file, got)
+			}
+			if got := patterns.FindBrowserForURL("https://jira.example.com/browse/A-1"); got != "/Applications/Firefox.app" {
+				t.Errorf("rules from an included TOML file should apply, got %s", got)
+			}
+			if shorteners := service.GetConfig().Shorteners; shorteners == nil || shorteners.MaxHops != 3 {
+				t.Errorf("numbers from TOML should be decoded, got %+v", shorteners)
+			}
+
+			// Saving keeps the format
+			if err := service.SetDefaultBrowser("/Applications/Firefox.app"); err != nil {
+				t.Fatalf("SetDefaultBrowser failed: %v", err)
+			}
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(strings.TrimSpace(string(data)), "{") || !strings.Contains(string(data), "Firefox.app") {
+				t.Errorf("%s should be saved in its own format, got:\n%s", tt.file, data)
+			}
+			reloaded, err := services.NewConfigServiceWithPath(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := reloaded.Load(); err != nil {
+				t.Fatalf("Load of the saved file failed: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(reloaded.GetConfig(), service.GetConfig()) {
+				t.Errorf("saved config differs:\n got %+v\nwant %+v", reloaded.GetConfig(), service.GetConfig())
+			}
+		})
+	}
+}
+
+func TestConfigService_InvalidFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"config.yaml": "browsers: [\n"})
+	service, err := services.NewConfigServiceWithPath(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(); err == nil || !strings.Contains(err.Error(), "invalid YAML in config file") {
+		t.Errorf("Load() error = %v, want invalid YAML", err)
+	}
+}
+
+func TestConfigService_ConvertConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{"config.yaml": yamlConfig, "team.toml": tomlTeamRules})
+	service, err := services.NewConfigServiceWithPath(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := service.GetConfig()
+
+	for _, format := range []services.ConfigFormat{services.FormatTOML, services.FormatJSON, services.FormatYAML} {
+		path, err := service.ConvertConfig(format)
+		if err != nil {
+			t.Fatalf("ConvertConfig(%s) failed: %v", format, err)
+		}
+		if got := services.ConfigFormatOf(path); got != format || service.GetConfigPath() != path {
+			t.Errorf("ConvertConfig(%s) wrote %s", format, path)
+		}
+		if !reflect.DeepEqual(service.GetConfig(), want) {
+			t.Errorf("config changed converting to %s:\n got %+v\nwant %+v", format, service.GetConfig(), want)
+		}
+	}
+
+	// The old files are kept as backups, and a new file never overwrites an existing one
+	for _, backup := range []string{"config.yaml.bak", "config.toml.bak", "config.json.bak"} {
+		if _, err := os.Stat(filepath.Join(dir, backup)); err != nil {
+			t.Errorf("missing backup %s", backup)
+		}
+	}
+	writeConfigFiles(t, dir, map[string]string{"config.json": "{}"})
+	if _, err := service.ConvertConfig(services.FormatJSON); err == nil {
+		t.Errorf("converting onto an existing file should fail")
+	}
+	if _, err := services.ParseConfigFormat("xml"); err == nil {
+		t.Errorf("unknown formats should be rejected")
+	}
+}
+
+func TestNewConfigService_ChoosesConfigFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		want         string
+		wantConflict string
+	}{
+		{"first launch", nil, "config.json", ""},
+		{"YAML next to an empty config.json", map[string]string{"config.json": "{\n  \"browsers\": [],\n  \"defaultBrowserURL\": \"\"\n}", "config.yaml": yamlConfig}, "config.yaml", ""},
+		{"TOML next to a config.json with only a comment", map[string]string{"config.json": "// TODO\n{}\n", "config.toml": tomlConfig}, "config.toml", ""},
+		{"config.json with rules wins", map[string]string{"config.json": `{"defaultBrowserURL": "/Applications/Arc.app"}`, "config.toml": tomlConfig}, "config.json", "ignoring config.toml"},
+		{"YAML before TOML", map[string]string{"config.yml": yamlConfig, "config.toml": tomlConfig}, "config.yml", "using config.yml and ignoring config.toml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			writeConfigFiles(t, filepath.Join(home, ".brb"), tt.files)
+
+			service, err := services.NewConfigService()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.Base(service.GetConfigPath()); got != tt.want {
+				t.Errorf("config file = %s, want %s", got, tt.want)
+			}
+			conflict := service.ConfigFileConflict()
+			if tt.wantConflict == "" && conflict != "" || !strings.Contains(conflict, tt.wantConflict) {
+				t.Errorf("ConfigFileConflict() = %q, want %q", conflict, tt.wantConflict)
+			}
+		})
+	}
+
+	// A config file written by hand after the first launch is picked up on the next one
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if _, err := services.NewConfigService(); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFiles(t, filepath.Join(home, ".brb"), map[string]string{"config.yaml": yamlConfig})
+	service, err := services.NewConfigService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(service.GetConfigPath()); got != "config.yaml" {
+		t.Errorf("config.yaml should be used instead of the config.json written on first launch, got %s", got)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFiles writes files relative to dir, creating directories as needed
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfigService_Includes(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(t.TempDir(), "team.json")
+	writeConfigFiles(t, dir, map[string]string{
+		"config.json": `{
+  "include": ["rules/work.json", "` + filepath.ToSlash(shared) + `"],
+  "browsers": [{ "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" }],
+  "defaultBrowserURL": "/Applications/Safari.app",
+  "shorteners": { "hosts": ["bit.ly"] }
+}`,
+		"rules/work.json": `{
+  "include": ["common.json"],
+  "browsers": [{ "patterns": ["jira.example.com"], "browserURL": "/Applications/Google Chrome.app" }],
+  "defaultBrowserURL": "/Applications/Arc.app",
+  "matchMode": "specific",
+  "shorteners": { "hosts": ["go.example.com"], "maxHops": 3 }
+}`,
+		"rules/common.json": `{
+  "browsers": [{ "patterns": ["github.com/example"], "browserURL": "/Applications/Google Chrome.app" }]
+}`,
+	})
+	writeConfigFiles(t, filepath.Dir(shared), map[string]string{
+		"team.json": `{ "include": ["` + filepath.ToSlash(filepath.Join(dir, "rules", "common.json")) + `"], "askTimeout": "30s" }`,
+	})
+
+	service, err := services.NewConfigServiceWithPath(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	config := service.GetConfig()
+	var patterns []string
+	for _, browser := range config.Browsers {
+		patterns = append(patterns, browser.Patterns[0])
+	}
+	// The config file first, then each include followed by the files it includes; common.json only once
+	if got, want := strings.Join(patterns, ","), "github.com,jira.example.com,github.com/example"; got != want {
+		t.Errorf("merged browsers = %s, want %s", got, want)
+	}
+	if config.DefaultBrowserURL != "/Applications/Safari.app" {
+		t.Errorf("the config file should win for single values, got %s", config.DefaultBrowserURL)
+	}
+	if config.MatchMode != "specific" || config.AskTimeout != "30s" {
+		t.Errorf("values only set by included files should be used, got %q and %q", config.MatchMode, config.AskTimeout)
+	}
+	if config.Shorteners == nil || strings.Join(config.Shorteners.Hosts, ",") != "bit.ly,go.example.com" || config.Shorteners.MaxHops != 3 {
+		t.Errorf("nested settings should be merged, got %+v", config.Shorteners)
+	}
+	if got := services.NewPatternServiceWithRules(service.GetRules()).FindBrowserForURL("https://jira.example.com/browse/A-1"); got != "/Applications/Google Chrome.app" {
+		t.Errorf("rules from included files should apply, got %s", got)
+	}
+
+	// Changing a setting only writes the config file, keeping its includes
+	if err := service.SetDefaultBrowser("/Applications/Firefox.app"); err != nil {
+		t.Fatalf("SetDefaultBrowser failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(data)
+	if !strings.Contains(saved, "rules/work.json") || strings.Contains(saved, "jira.example.com") || strings.Contains(saved, "specific") {
+		t.Errorf("save should keep the include list and leave included entries out, got %s", saved)
+	}
+	if got := service.GetConfig(); got.DefaultBrowserURL != "/Applications/Firefox.app" || len(got.Browsers) != 3 {
+		t.Errorf("included files should still be merged after saving, got %+v", got)
+	}
+}
+
+func TestConfigService_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		errors []string
+	}{
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.json": `{ "include": ["missing.json"], "browsers": [] }`,
+			},
+			errors: []string{`include[0] "missing.json": open `},
+		},
+		{
+			name: "invalid JSON in an include",
+			files: map[string]string{
+				"config.json":  `{ "include": ["rules/a.json"], "browsers": [] }`,
+				"rules/a.json": `{ "include": ["b.json"] }`,
+				"rules/b.json": `{ "browsers": [ }`,
+			},
+			errors: []string{`rules/a.json: include[0] "b.json": invalid JSON in rules/b.json`},
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"config.json": `{ "include": ["a.json"], "browsers": [] }`,
+				"a.json":      `{ "include": ["b.json"] }`,
+				"b.json":      `{ "include": ["a.json", "config.json"] }`,
+			},
+			errors: []string{
+				`b.json: include[0] "a.json": include cycle: a.json -> b.json -> a.json`,
+				`b.json: include[1] "config.json": include cycle: config.json -> a.json -> b.json -> config.json`,
+			},
+		},
+		{
+			name: "invalid rule in an include",
+			files: map[string]string{
+				"config.json": `{ "include": ["team.json"], "browsers": [{ "patterns": ["a"], "browserURL": "/Applications/Safari.app" }], "matchMode": "best" }`,
+				"team.json": `{ "browsers": [
+  { "patterns": ["b"], "browserURL": "/Applications/Safari.app" },
+  { "regexPatterns": ["[b"], "browserURL": "/Applications/Safari.app" }
+] }`,
+			},
+			errors: []string{`matchMode: unknown match mode`, `team.json: browsers[1].regexPatterns[0] "[b"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, tt.files)
+			service, err := services.NewConfigServiceWithPath(filepath.Join(dir, "config.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = service.Load()
+			var configErrs services.ConfigErrors
+			if !errors.As(err, &configErrs) {
+				t.Fatalf("Load() error = %v, want ConfigErrors", err)
+			}
+			if len(configErrs) != len(tt.errors) {
+				t.Fatalf("Load() returned %d errors, want %d: %v", len(configErrs), len(tt.errors), err)
+			}
+			for i, want := range tt.errors {
+				if got := configErrs[i].Error(); !strings.HasPrefix(got, want) {
+					t.Errorf("error %d = %q, want prefix %q", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package services
 
 import (
 	"browserRedirectBar/src/services"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -90,3 +93,47 @@ func stringsEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestConfigService_Load_KeepsLastGoodConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"browsers": [{"regexPatterns": ["github\\.com"], "browserURL": "/Applications/Chrome.app"}], "defaultBrowserURL": ""}`)
+	service, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatalf("NewConfigServiceWithPath() error: %v", err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load() error on valid config: %v", err)
+	}
+
+	// A typo in a regex is reported with its location instead of silently disabling the rule
+	writeConfig(`{"browsers": [{"regexPatterns": ["gitlab\\.com("], "browserURL": "/Applications/Firefox.app"}], "defaultBrowserURL": ""}`)
+	err = service.Load()
+	var configErrs services.ConfigErrors
+	if !errors.As(err, &configErrs) || len(configErrs) != 1 {
+		t.Fatalf("expected one rule error, got %v", err)
+	}
+	if configErrs[0].Index != 0 || configErrs[0].Pattern != `gitlab\.com(` {
+		t.Errorf("unexpected error location: %v", configErrs[0])
+	}
+
+	patternService := services.NewPatternServiceWithRules(service.GetRules())
+	if result := patternService.FindBrowserForURL("https://github.com/"); result != "/Applications/Chrome.app" {
+		t.Errorf("last good rules should stay active, got %q", result)
+	}
+
+	// Broken JSON keeps the last good config as well
+	writeConfig(`{"browsers": [`)
+	if err := service.Load(); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+	if browsers := service.GetConfig().Browsers; len(browsers) != 1 || browsers[0].BrowserURL != "/Applications/Chrome.app" {
+		t.Errorf("last good config should stay active, got %+v", browsers)
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"strings"
+	"testing"
+)
+
+func TestPatternService_Explain(t *testing.T) {
+	config := services.Config{
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"gitlab.com"}, BrowserURL: "/Applications/Firefox.app"},
+			{SourceApps: []string{"com.tinyspeck.slackmacgap"}, Patterns: []string{"github.com"}, BrowserURL: "/Applications/Slack Links.app"},
+			{Patterns: []string{"github.com"}, ExcludePatterns: []string{"/enterprise"}, BrowserURL: "/Applications/Chrome.app", Profile: "Profile 1"},
+			{Matchers: []services.URLMatcher{{Domain: "github.com"}}, BrowserURL: "/Applications/Arc.app"},
+		},
+		Rewrites: []services.RewriteRule{{Find: "^http://", Replace: "https://"}},
+	}
+	service := services.NewPatternService(config)
+	service.SetURLPipeline(services.NewURLPipeline(services.NewRewriteService(config.Rewrites)))
+	service.SetParamScrubber(services.NewParamScrubber(nil))
+
+	decision := service.Explain(services.URLRequest{URL: "http://github.com/org/repo?utm_source=mail", SourceApp: "com.apple.mail"})
+
+	if decision.BrowserURL != "/Applications/Chrome.app" || decision.Launch.Profile != "Profile 1" || decision.RuleIndex != 2 || decision.Fallback != services.FallbackNone {
+		t.Errorf("unexpected decision: rule %d, browser %q, profile %q, fallback %q", decision.RuleIndex, decision.BrowserURL, decision.Launch.Profile, decision.Fallback)
+	}
+	if decision.MatchURL != "https://github.com/org/repo" || decision.OpenURL != decision.MatchURL {
+		t.Errorf("rules should see the rewritten and scrubbed URL, got %q / %q", decision.MatchURL, decision.OpenURL)
+	}
+	if len(decision.Stages) != 1 || !decision.Stages[0].Changed() || decision.Stages[0].Stage != "rewrite" {
+		t.Errorf("expected the applied rewrite in the trace, got %+v", decision.Stages)
+	}
+	if !stringsEqual(decision.RemovedParams, []string{"utm_source"}) {
+		t.Errorf("RemovedParams = %v", decision.RemovedParams)
+	}
+
+	expected := []services.RuleOutcome{services.RuleNoMatch, services.RuleConditionsNotMet, services.RuleSelected, services.RuleMatched}
+	if len(decision.Rules) != len(expected) {
+		t.Fatalf("expected every rule in the trace, got %d", len(decision.Rules))
+	}
+	for i, outcome := range expected {
+		if decision.Rules[i].Outcome != outcome {
+			t.Errorf("rule %d outcome = %q, want %q", i, decision.Rules[i].Outcome, outcome)
+		}
+	}
+	checks := decision.Rules[1].Checks
+	if len(checks) != 2 || checks[0].Kind != "sourceApps" || checks[0].Passed || checks[1].Kind != "pattern" || !checks[1].Passed {
+		t.Errorf("source app rule should record the failed condition and the matching pattern, got %+v", checks)
+	}
+	checks = decision.Rules[2].Checks
+	if len(checks) != 2 || checks[1].Kind != "excludePattern" || checks[1].Passed {
+		t.Errorf("exclude check should be recorded, got %+v", checks)
+	}
+
+	trace := decision.String()
+	for _, want := range []string{"rewrite: http://github.com/org/repo?utm_source=mail -> https://github.com/org/repo?utm_source=mail", "removed tracking parameters: utm_source", "rule 1 -> /Applications/Slack Links.app (priority 0): conditions not met", "rule 2 selected /Applications/Chrome.app (profile Profile 1)"} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("trace is missing %q:\n%s", want, trace)
+		}
+	}
+}
+
+func TestPatternService_ResolveFallbacks(t *testing.T) {
+	rules := []services.BrowserConfig{
+		{Patterns: []string{"github.com"}, BrowserURL: "/Applications/Chrome.app"},
+		{Patterns: []string{"shop.example.com"}, KeepTrackingParams: true, BrowserURL: "/Applications/Firefox.app"},
+	}
+
+	tests := []struct {
+		name           string
+		defaultBrowser string
+		url            string
+		browser        string
+		openURL        string
+		fallback       string
+	}{
+		{"Rule matches", "/Applications/Arc.app", "https://github.com/?gclid=1", "/Applications/Chrome.app", "https://github.com/", services.FallbackNone},
+		{"Rule keeps tracking parameters", "", "https://shop.example.com/?gclid=1", "/Applications/Firefox.app", "https://shop.example.com/?gclid=1", services.FallbackNone},
+		{"Default browser", "/Applications/Arc.app", "https://example.com/", "/Applications/Arc.app", "https://example.com/", services.FallbackDefault},
+		{"Safari when no default is set", "", "https://example.com/", "/Applications/Safari.app", "https://example.com/", services.FallbackSafari},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := services.NewPatternService(services.Config{Browsers: rules, DefaultBrowserURL: tt.defaultBrowser})
+			service.SetParamScrubber(services.NewParamScrubber(nil))
+
+			for _, decision := range []services.Decision{service.Resolve(services.URLRequest{URL: tt.url}), service.Explain(services.URLRequest{URL: tt.url})} {
+				if decision.BrowserURL != tt.browser || decision.OpenURL != tt.openURL || decision.Fallback != tt.fallback {
+					t.Errorf("got browser %q, open %q, fallback %q; want %q, %q, %q", decision.BrowserURL, decision.OpenURL, decision.Fallback, tt.browser, tt.openURL, tt.fallback)
+				}
+			}
+		})
+	}
+}
+
+func TestPatternService_ExplainAgreesWithResolve(t *testing.T) {
+	config := indexTestConfig(300)
+	config.MatchMode = services.MatchModeSpecific
+	config.Browsers[1].Priority = 5
+	service := services.NewPatternService(config)
+
+	for _, rawURL := range indexTestURLs(300) {
+		resolved := service.Resolve(services.URLRequest{URL: rawURL})
+		explained := service.Explain(services.URLRequest{URL: rawURL})
+		if resolved.RuleIndex != explained.RuleIndex || resolved.BrowserURL != explained.BrowserURL {
+			t.Errorf("%s: Resolve chose rule %d, Explain chose rule %d", rawURL, resolved.RuleIndex, explained.RuleIndex)
+		}
+		if len(explained.Rules) != len(config.Browsers) {
+			t.Errorf("%s: Explain should trace all %d rules, got %d", rawURL, len(config.Browsers), len(explained.Rules))
+		}
+	}
+}
+
+func TestPatternService_RoutesOtherSchemes(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{RegexPatterns: []string{`^mailto:[^?]*@work\.example\.com`}, BrowserURL: "/Applications/Outlook.app"},
+			{Matchers: []services.URLMatcher{{Scheme: "zoommtg"}}, BrowserURL: "/Applications/zoom.us.app"},
+			{Matchers: []services.URLMatcher{{Scheme: "sms"}, {Host: "ask.example.com"}}, Ask: true},
+		},
+		DefaultBrowserURL: "/Applications/Firefox.app",
+		DefaultApps: map[string]string{
+			"mailto": "/System/Applications/Mail.app",
+			"TEL":    "/System/Applications/FaceTime.app",
+			"sms":    "/System/Applications/Messages.app",
+		},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		browser  string
+		fallback string
+	}{
+		{"Rule by scheme", "zoommtg://zoom.us/join?confno=123", "/Applications/zoom.us.app", services.FallbackNone},
+		{"Rule by regex on mailto", "mailto:someone@work.example.com?subject=Hi", "/Applications/Outlook.app", services.FallbackNone},
+		{"Default app for mailto", "mailto:friend@example.org", "/System/Applications/Mail.app", services.FallbackDefaultApp},
+		{"Default app keys are case-insensitive", "tel:+31 20 123 4567", "/System/Applications/FaceTime.app", services.FallbackDefaultApp},
+		{"Unknown scheme is not handed back to the system", "slack://open?team=T1", "", services.FallbackUnhandled},
+		{"Web URLs still use the default browser", "https://example.com/", "/Applications/Firefox.app", services.FallbackDefault},
+		{"Rule without a browser uses the default app", "sms:+31201234567", "/System/Applications/Messages.app", services.FallbackNone},
+		{"Rule without a browser uses the default browser", "https://ask.example.com/", "/Applications/Firefox.app", services.FallbackNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := service.Resolve(services.URLRequest{URL: tt.url})
+			if decision.BrowserURL != tt.browser || decision.Fallback != tt.fallback {
+				t.Errorf("Resolve(%q) = %q (fallback %q), want %q (fallback %q)", tt.url, decision.BrowserURL, decision.Fallback, tt.browser, tt.fallback)
+			}
+			if decision.OpenURL != tt.url {
+				t.Errorf("OpenURL = %q, want the URL unchanged", decision.OpenURL)
+			}
+			explained := service.Explain(services.URLRequest{URL: tt.url})
+			if matched := tt.fallback == services.FallbackNone; matched == strings.Contains(explained.String(), "no rule matched") {
+				t.Errorf("Explain(%q) should report whether a rule matched:\n%s", tt.url, explained)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const commentedConfig = `// brb config, see README
+{
+  "browsers": [
+    // Work
+    {
+      "patterns": ["jira.example.com"],
+      "browserURL": "/Applications/Google Chrome.app", // company profile
+    },
+    /* Code review */
+    { "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" },
+  ],
+  "defaultBrowserURL": "/Applications/Safari.app", // everything else
+  "x-notes": "kept even though brb doesn't know it",
+}
+`
+
+// writeCommentedConfig writes a config file with comments and returns a service for it
+func writeCommentedConfig(t *testing.T, content string) (*services.ConfigService, string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return service, configPath
+}
+
+// assertConfigFile compares the config file with the expected text
+func assertConfigFile(t *testing.T, configPath string, want string) {
+	t.Helper()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("config file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestConfigService_LoadJSONC(t *testing.T) {
+	service, _ := writeCommentedConfig(t, commentedConfig)
+	config := service.GetConfig()
+	if len(config.Browsers) != 2 || config.Browsers[1].BrowserURL != "/Applications/Firefox.app" || config.DefaultBrowserURL != "/Applications/Safari.app" {
+		t.Errorf("config with comments and trailing commas = %+v", config)
+	}
+
+	// Comment markers inside strings are text
+	service, _ = writeCommentedConfig(t, `{ "browsers": [{ "patterns": ["https://a.example.com/*,]"], "browserURL": "/b" }], "defaultBrowserURL": "/* not a comment */" }`)
+	if got := service.GetConfig(); got.Browsers[0].Patterns[0] != "https://a.example.com/*,]" || got.DefaultBrowserURL != "/* not a comment */" {
+		t.Errorf("strings should be kept as written, got %+v", got)
+	}
+}
+
+func TestConfigService_EditsKeepComments(t *testing.T) {
+	service, configPath := writeCommentedConfig(t, commentedConfig)
+
+	if err := service.SetDefaultBrowserProfile("/Applications/Google Chrome.app", "Profile 1"); err != nil {
+		t.Fatalf("SetDefaultBrowserProfile failed: %v", err)
+	}
+	assertConfigFile(t, configPath, `// brb config, see README
+{
+  "browsers": [
+    // Work
+    {
+      "patterns": ["jira.example.com"],
+      "browserURL": "/Applications/Google Chrome.app", // company profile
+    },
+    /* Code review */
+    { "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" },
+  ],
+  "defaultBrowserURL": "/Applications/Google Chrome.app", // everything else
+  "x-notes": "kept even though brb doesn't know it",
+  "defaultBrowserProfile": "Profile 1",
+}
+`)
+
+	// A learned rule goes above the rule it overrides, and above that rule's comment
+	if _, err := service.AddLearnedRule("https://jira.example.com/browse/A-1", "/Applications/Arc.app", ""); err != nil {
+		t.Fatalf("AddLearnedRule failed: %v", err)
+	}
+	// Without a matching rule it goes at the end
+	if _, err := service.AddLearnedRule("https://news.example.org/", "/Applications/Safari.app", ""); err != nil {
+		t.Fatalf("AddLearnedRule failed: %v", err)
+	}
+	if err := service.SetDefaultBrowser("/Applications/Safari.app"); err != nil {
+		t.Fatalf("SetDefaultBrowser failed: %v", err)
+	}
+	assertConfigFile(t, configPath, `// brb config, see README
+{
+  "browsers": [
+    {
+      "patterns": null,
+      "regexPatterns": null,
+      "matchers": [
+        {
+          "domain": "example.com"
+        }
+      ],
+      "browserURL": "/Applications/Arc.app",
+      "learned": true
+    },
+    // Work
+    {
+      "patterns": ["jira.example.com"],
+      "browserURL": "/Applications/Google Chrome.app", // company profile
+    },
+    /* Code review */
+    { "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" },
+    {
+      "patterns": null,
+      "regexPatterns": null,
+      "matchers": [
+        {
+          "domain": "example.org"
+        }
+      ],
+      "browserURL": "/Applications/Safari.app",
+      "learned": true
+    },
+  ],
+  "defaultBrowserURL": "/Applications/Safari.app", // everything else
+  "x-notes": "kept even though brb doesn't know it",
+}
+`)
+
+	// Removing the learned rules restores the original text
+	for _, domain := range []string{"example.org", "example.com"} {
+		if err := service.RemoveLearnedRule(domain); err != nil {
+			t.Fatalf("RemoveLearnedRule(%s) failed: %v", domain, err)
+		}
+	}
+	assertConfigFile(t, configPath, commentedConfig)
+}
+
+func TestConfigService_EditsKeepLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "one line",
+			content: `{"browsers": [{"patterns": ["a.example.net"], "browserURL": "/b"}], "defaultBrowserURL": "/c"}`,
+			want:    `{"browsers": [{"patterns":null,"regexPatterns":null,"matchers":[{"domain":"example.net"}],"browserURL":"/Applications/Arc.app","learned":true}, {"patterns": ["a.example.net"], "browserURL": "/b"}], "defaultBrowserURL": "/Applications/Arc.app"}`,
+		},
+		{
+			name:    "tabs and no browsers",
+			content: "{\n\t\"defaultBrowserURL\": \"/c\" /* fallback */\n}\n",
+			want:    "{\n\t\"defaultBrowserURL\": \"/Applications/Arc.app\", /* fallback */\n\t\"browsers\": [\n\t\t{\n\t\t\t\"patterns\": null,\n\t\t\t\"regexPatterns\": null,\n\t\t\t\"matchers\": [\n\t\t\t\t{\n\t\t\t\t\t\"domain\": \"example.net\"\n\t\t\t\t}\n\t\t\t],\n\t\t\t\"browserURL\": \"/Applications/Arc.app\",\n\t\t\t\"learned\": true\n\t\t}\n\t]\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, configPath := writeCommentedConfig(t, tt.content)
+			if err := service.SetDefaultBrowser("/Applications/Arc.app"); err != nil {
+				t.Fatalf("SetDefaultBrowser failed: %v", err)
+			}
+			if _, err := service.AddLearnedRule("https://a.example.net/", "/Applications/Arc.app", ""); err != nil {
+				t.Fatalf("AddLearnedRule failed: %v", err)
+			}
+			assertConfigFile(t, configPath, tt.want)
+		})
+	}
+}
+
+func TestConfigService_EditsFollowSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "brb.json")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte(commentedConfig), 0640); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.Symlink(target, configPath); err != nil {
+		t.Fatal(err)
+	}
+	service, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.SetDefaultBrowser("/Applications/Firefox.app"); err != nil {
+		t.Fatalf("SetDefaultBrowser failed: %v", err)
+	}
+	if info, err := os.Lstat(configPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("config.json should still be a symlink, got %v, %v", info, err)
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("the target should keep its permissions, got %v, %v", info, err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"defaultBrowserURL": "/Applications/Firefox.app", // everything else`) {
+		t.Errorf("the target should be edited in place, got:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("no temporary files should be left, got %v", entries)
+	}
+}
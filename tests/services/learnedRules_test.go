@@ -0,0 +1,167 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigService_LearnedRules(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	service, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatalf("NewConfigServiceWithPath failed: %v", err)
+	}
+
+	// A hand edit made after the service loaded the file must survive
+	handEdited := `{
+  "browsers": [
+    { "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" },
+    { "patterns": ["docs.google.com"], "browserURL": "/Applications/Google Chrome.app", "ask": true, "priority": 2 }
+  ],
+  "defaultBrowserURL": "/Applications/Safari.app"
+}`
+	if err := os.WriteFile(configPath, []byte(handEdited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		url     string
+		browser string
+		profile string
+	}{
+		{"https://www.example.com/page", "/Applications/Firefox.app", ""},
+		{"https://docs.google.com/document/d/1", "/Applications/Google Chrome.app", "Profile 1"},
+		{"https://blog.example.com/", "/Applications/Arc.app", ""},
+		{"http://192.168.1.10:8080/", "/Applications/Safari.app", ""},
+	}
+	for _, step := range steps {
+		if _, err := service.AddLearnedRule(step.url, step.browser, step.profile); err != nil {
+			t.Fatalf("AddLearnedRule(%q) failed: %v", step.url, err)
+		}
+	}
+	if _, err := service.AddLearnedRule("mailto:someone@example.com", "/Applications/Mail.app", ""); err == nil {
+		t.Errorf("a URL without a host cannot be learned")
+	}
+
+	// Reload from disk to check what was saved
+	reloaded, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browsers := reloaded.GetConfig().Browsers
+	if len(browsers) != 5 || browsers[0].Patterns[0] != "github.com" || reloaded.GetConfig().DefaultBrowserURL != "/Applications/Safari.app" {
+		t.Fatalf("hand-written rules should be kept, got %+v", browsers)
+	}
+	// The choice for docs.google.com goes before the ask rule, with its priority, so it takes effect
+	if !browsers[1].Learned || browsers[1].Matchers[0].Domain != "google.com" || browsers[1].Priority != 2 || !browsers[2].Ask {
+		t.Errorf("learned rule should be inserted before the rule that matched, got %+v", browsers[:3])
+	}
+
+	expected := []services.LearnedRule{
+		{Index: 1, Domain: "google.com", BrowserURL: "/Applications/Google Chrome.app", Profile: "Profile 1"},
+		{Index: 3, Domain: "example.com", BrowserURL: "/Applications/Arc.app"},
+		{Index: 4, Domain: "192.168.1.10", BrowserURL: "/Applications/Safari.app"},
+	}
+	learned := reloaded.LearnedRules()
+	if len(learned) != len(expected) {
+		t.Fatalf("LearnedRules() = %+v, want %+v", learned, expected)
+	}
+	for i := range expected {
+		if learned[i] != expected[i] {
+			t.Errorf("learned rule %d = %+v, want %+v", i, learned[i], expected[i])
+		}
+	}
+
+	patternService := services.NewPatternServiceWithRules(reloaded.GetRules())
+	for url, browser := range map[string]string{
+		"https://shop.example.com/":       "/Applications/Arc.app",
+		"https://docs.google.com/sheet/1": "/Applications/Google Chrome.app",
+		"http://192.168.1.10/admin":       "/Applications/Safari.app",
+		"https://github.com/org/repo":     "/Applications/Firefox.app",
+	} {
+		if result := patternService.FindBrowserForURL(url); result != browser {
+			t.Errorf("FindBrowserForURL(%q) = %q, want %q", url, result, browser)
+		}
+	}
+
+	if err := reloaded.RemoveLearnedRule("Example.com"); err != nil {
+		t.Fatalf("RemoveLearnedRule failed: %v", err)
+	}
+	if err := reloaded.RemoveLearnedRule("example.com"); err == nil {
+		t.Errorf("removing a rule twice should fail")
+	}
+	if learned := reloaded.LearnedRules(); len(learned) != 2 || learned[1].Domain != "192.168.1.10" {
+		t.Errorf("expected example.com to be forgotten, got %+v", learned)
+	}
+}
+
+func TestConfigService_EditsWithInvalidRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		wantDefault string
+	}{
+		{"invalid regex", "config.json", `{
+  "browsers": [
+    { "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" },
+    { "regexPatterns": ["(unclosed"], "browserURL": "/Applications/Arc.app" }
+  ],
+  "defaultBrowserURL": "/Applications/Safari.app"
+}`, `"defaultBrowserURL": "/Applications/Arc.app"`},
+		{"missing include", "config.json", `{
+  "browsers": [{ "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" }],
+  "defaultBrowserURL": "/Applications/Safari.app",
+  "include": ["missing.json"]
+}`, `"defaultBrowserURL": "/Applications/Arc.app"`},
+		{"invalid regex in YAML", "config.yaml", `browsers:
+  - patterns: [github.com]
+    browserURL: /Applications/Firefox.app
+  - regexPatterns: ["(unclosed"]
+    browserURL: /Applications/Arc.app
+defaultBrowserURL: /Applications/Safari.app
+`, "defaultBrowserURL: /Applications/Arc.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, map[string]string{tt.file: tt.content})
+			configPath := filepath.Join(dir, tt.file)
+			service, err := services.NewConfigServiceWithPath(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ruleErrs services.ConfigErrors
+			if err := service.Load(); !errors.As(err, &ruleErrs) {
+				t.Fatalf("Load() error = %v, want ConfigErrors", err)
+			}
+
+			// Each change is saved and the invalid rules are still reported
+			if err := service.SetDefaultBrowser("/Applications/Arc.app"); !errors.As(err, &ruleErrs) {
+				t.Errorf("SetDefaultBrowser() error = %v, want ConfigErrors", err)
+			}
+			if rule, err := service.AddLearnedRule("https://news.example.org/", "/Applications/Firefox.app", ""); !errors.As(err, &ruleErrs) || !rule.Learned {
+				t.Errorf("AddLearnedRule() = %+v, %v; want the rule and ConfigErrors", rule, err)
+			}
+			if learned := service.LearnedRules(); len(learned) != 1 || learned[0].Domain != "example.org" {
+				t.Fatalf("learned rules = %+v", learned)
+			}
+			if err := service.RemoveLearnedRule("example.org"); !errors.As(err, &ruleErrs) {
+				t.Errorf("RemoveLearnedRule() error = %v, want ConfigErrors", err)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.wantDefault) || strings.Contains(string(data), "example.org") || !strings.Contains(string(data), "github.com") {
+				t.Errorf("config file should have the default browser change and no learned rule:\n%s", data)
+			}
+		})
+	}
+}
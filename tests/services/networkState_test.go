@@ -0,0 +1,173 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeNetworkState is a NetworkStateProvider returning a fixed state and counting snapshots
+type fakeNetworkState struct {
+	state services.NetworkState
+	err   error
+	calls int
+}
+
+// Snapshot implements NetworkStateProvider interface
+func (f *fakeNetworkState) Snapshot() (services.NetworkState, error) {
+	f.calls++
+	return f.state, f.err
+}
+
+// movableClock is a Clock whose time can be advanced by tests
+type movableClock struct {
+	now time.Time
+}
+
+// Now implements Clock interface
+func (c *movableClock) Now() time.Time {
+	return c.now
+}
+
+func vpnConfig() services.Config {
+	return services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:   []services.URLMatcher{{Host: "*.corp.example.com"}},
+				Network:    &services.NetworkCondition{Interfaces: []string{"utun*"}, CIDRs: []string{"10.8.0.0/16"}},
+				BrowserURL: "/Applications/Corporate Browser.app",
+			},
+			{
+				Patterns:   []string{"wiki"},
+				Network:    &services.NetworkCondition{SearchDomains: []string{"corp.example.com"}},
+				BrowserURL: "/Applications/Wiki Browser.app",
+			},
+		},
+	}
+}
+
+func TestPatternService_NetworkConditions(t *testing.T) {
+	connected := services.NetworkState{
+		Interfaces: []services.NetworkInterface{
+			{Name: "en0", Up: true, Addrs: []net.IP{net.ParseIP("192.168.1.20")}},
+			{Name: "utun4", Up: true, Addrs: []net.IP{net.ParseIP("10.8.3.7")}},
+		},
+		SearchDomains: []string{"Corp.Example.com."},
+	}
+	disconnected := services.NetworkState{
+		Interfaces: []services.NetworkInterface{
+			{Name: "en0", Up: true, Addrs: []net.IP{net.ParseIP("192.168.1.20")}},
+			{Name: "utun4", Up: false, Addrs: []net.IP{net.ParseIP("10.8.3.7")}},
+		},
+	}
+	wrongRange := services.NetworkState{
+		Interfaces: []services.NetworkInterface{
+			{Name: "utun4", Up: true, Addrs: []net.IP{net.ParseIP("172.16.0.2")}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		state    services.NetworkState
+		url      string
+		expected string
+	}{
+		{"VPN up and address in range", connected, "https://jira.corp.example.com", "/Applications/Corporate Browser.app"},
+		{"VPN interface down", disconnected, "https://jira.corp.example.com", ""},
+		{"VPN interface up with address outside range", wrongRange, "https://jira.corp.example.com", ""},
+		{"Search domain present", connected, "https://wiki.example.org", "/Applications/Wiki Browser.app"},
+		{"Search domain absent", disconnected, "https://wiki.example.org", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := services.NewPatternService(vpnConfig())
+			service.SetNetworkState(&fakeNetworkState{state: tt.state})
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_NetworkStateReadOncePerURL(t *testing.T) {
+	provider := &fakeNetworkState{err: errors.New("no network")}
+	service := services.NewPatternService(vpnConfig())
+	service.SetNetworkState(provider)
+
+	if result := service.FindBrowserForURL("https://wiki.corp.example.com"); result != "" {
+		t.Errorf("unreadable network state should fail network conditions, got %q", result)
+	}
+	if provider.calls != 1 {
+		t.Errorf("network state should be read once per URL, got %d reads", provider.calls)
+	}
+
+	// Only URLs that can match a network rule need the network state
+	service.FindBrowserForURL("https://example.com")
+	if provider.calls != 1 {
+		t.Errorf("network state should not be read when no network rule can match, got %d reads", provider.calls)
+	}
+
+	service.FindBrowserForURL("https://wiki.example.org")
+	if provider.calls != 2 {
+		t.Errorf("network state should be re-read for the next URL, got %d reads", provider.calls)
+	}
+}
+
+func TestPatternService_NetworkStateNotReadWithoutNetworkRules(t *testing.T) {
+	provider := &fakeNetworkState{}
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{{Patterns: []string{"example"}, BrowserURL: "/Applications/Chrome.app"}},
+	})
+	service.SetNetworkState(provider)
+
+	service.FindBrowserForURL("https://example.com")
+	if provider.calls != 0 {
+		t.Errorf("network state should not be read when no rule needs it, got %d reads", provider.calls)
+	}
+}
+
+func TestCachedNetworkState(t *testing.T) {
+	provider := &fakeNetworkState{}
+	clock := &movableClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cached := services.NewCachedNetworkStateWithClock(provider, 5*time.Second, clock)
+
+	_, _ = cached.Snapshot()
+	clock.now = clock.now.Add(4 * time.Second)
+	_, _ = cached.Snapshot()
+	if provider.calls != 1 {
+		t.Errorf("snapshot within TTL should be cached, got %d reads", provider.calls)
+	}
+
+	clock.now = clock.now.Add(2 * time.Second)
+	_, _ = cached.Snapshot()
+	if provider.calls != 2 {
+		t.Errorf("snapshot after TTL should be re-read, got %d reads", provider.calls)
+	}
+}
+
+func TestParseSearchDomains(t *testing.T) {
+	scutil := `DNS configuration
+
+resolver #1
+  search domain[0] : corp.example.com
+  search domain[1] : example.com
+  nameserver[0] : 10.8.0.1
+
+resolver #2
+  search domain[0] : corp.example.com
+`
+	got := services.ParseScutilSearchDomains(scutil)
+	if !stringsEqual(got, []string{"corp.example.com", "example.com"}) {
+		t.Errorf("ParseScutilSearchDomains = %v", got)
+	}
+
+	resolvConf := "# comment\nnameserver 10.0.0.1\nsearch corp.example.com lab.example.com\ndomain example.com\n"
+	got = services.ParseResolvConfSearchDomains(resolvConf)
+	if !stringsEqual(got, []string{"corp.example.com", "lab.example.com", "example.com"}) {
+		t.Errorf("ParseResolvConfSearchDomains = %v", got)
+	}
+}
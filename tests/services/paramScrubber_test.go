@@ -0,0 +1,93 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"testing"
+)
+
+func TestParamScrubber_Scrub(t *testing.T) {
+	scrubber := services.NewParamScrubber(&services.TrackingParamsConfig{
+		Remove: []string{"ref_src", "sessionid"},
+		Keep:   []string{"utm_keep"},
+		Domains: []services.DomainParamOverride{
+			{Domain: "shop.example.com", Keep: []string{"gclid"}},
+			{Domain: "news.example.org", Remove: []string{"ref"}},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		removed  int
+	}{
+		{"Removes default tracking parameters", "https://example.com/a?utm_source=mail&utm_medium=email&id=5", "https://example.com/a?id=5", 2},
+		{"Removes click ids and keeps order", "https://example.com/?b=2&fbclid=x&a=1&gclid=y&mc_eid=z", "https://example.com/?b=2&a=1", 3},
+		{"Removes every parameter and the question mark", "https://example.com/post?utm_campaign=x", "https://example.com/post", 1},
+		{"Keeps the fragment", "https://example.com/?utm_source=x#section", "https://example.com/#section", 1},
+		{"Parameter names are case-insensitive", "https://example.com/?UTM_Source=x&q=1", "https://example.com/?q=1", 1},
+		{"Removes configured extra parameters", "https://twitter.example/?ref_src=tw&s=20", "https://twitter.example/?s=20", 1},
+		{"Global keep wins over defaults", "https://example.com/?utm_keep=1&utm_source=x", "https://example.com/?utm_keep=1", 1},
+		{"Domain keep wins over defaults", "https://shop.example.com/?gclid=abc&utm_source=x", "https://shop.example.com/?gclid=abc", 1},
+		{"Domain override covers subdomains", "https://www.news.example.org/?ref=home&id=1", "https://www.news.example.org/?id=1", 1},
+		{"Domain override does not leak to other domains", "https://example.net/?ref=home", "https://example.net/?ref=home", 0},
+		{"Preserves encoding of remaining values", "https://example.com/?q=a%20b&utm_source=x", "https://example.com/?q=a%20b", 1},
+		{"Leaves URLs without query untouched", "https://example.com/path", "https://example.com/path", 0},
+		{"Leaves non-web schemes untouched", "mailto:someone@example.com?utm_source=x", "mailto:someone@example.com?utm_source=x", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, removed := scrubber.Scrub(tt.url)
+			if result != tt.expected {
+				t.Errorf("Scrub(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+			if len(removed) != tt.removed {
+				t.Errorf("Scrub(%q) removed %v, want %d parameters", tt.url, removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestParamScrubber_DefaultsAndDisabled(t *testing.T) {
+	url := "https://example.com/?utm_source=x&id=1"
+
+	if result, _ := services.NewParamScrubber(nil).Scrub(url); result != "https://example.com/?id=1" {
+		t.Errorf("nil config should use the built-in list, got %q", result)
+	}
+
+	scrubber := services.NewParamScrubber(&services.TrackingParamsConfig{Disabled: true})
+	if result, removed := scrubber.Scrub(url); result != url || len(removed) != 0 {
+		t.Errorf("disabled scrubber should not change the URL, got %q", result)
+	}
+}
+
+func TestParamScrubber_KeepTrackingParamsPerRule(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:           []services.URLMatcher{{Host: "analytics.example.com"}},
+				KeepTrackingParams: true,
+				BrowserURL:         "/Applications/Chrome.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Query: map[string]string{"utm_source": ""}}},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+		},
+	}
+	scrubber := services.NewParamScrubber(testConfig.TrackingParams)
+	patternService := services.NewPatternService(testConfig)
+
+	// Matching always runs on the cleaned URL
+	clean, _ := scrubber.Scrub("https://blog.example.com/?utm_source=x")
+	if _, ok := patternService.FindRuleForRequest(services.URLRequest{URL: clean}); ok {
+		t.Errorf("rules should not see scrubbed parameters in %q", clean)
+	}
+
+	clean, _ = scrubber.Scrub("https://analytics.example.com/?utm_source=x")
+	rule, ok := patternService.FindRuleForRequest(services.URLRequest{URL: clean})
+	if !ok || !rule.KeepTrackingParams {
+		t.Fatalf("expected the analytics rule with keepTrackingParams, got %+v (found %v)", rule, ok)
+	}
+}
@@ -184,3 +184,256 @@ func TestPatternService_InvalidRegexPattern(t *testing.T) {
 		t.Errorf("Invalid regex should not match, got %q", result)
 	}
 }
+
+func TestPatternService_Priority(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"example.com"},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				Patterns:   []string{"example.com/admin"},
+				BrowserURL: "/Applications/Firefox.app",
+				Priority:   10,
+			},
+			{
+				Patterns:   []string{"example.com/admin/users"},
+				BrowserURL: "/Applications/Arc.app",
+				Priority:   10,
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Only low priority rule matches", "https://example.com/", "/Applications/Chrome.app"},
+		{"Higher priority beats earlier rule", "https://example.com/admin", "/Applications/Firefox.app"},
+		{"Equal priority falls back to config order", "https://example.com/admin/users", "/Applications/Firefox.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_MostSpecificMatch(t *testing.T) {
+	testConfig := services.Config{
+		MatchMode: services.MatchModeSpecific,
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"google.com"},
+				BrowserURL: "/Applications/Safari.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Domain: "google.com"}},
+				BrowserURL: "/Applications/Edge.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "*.google.com"}},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "*.docs.google.com"}},
+				BrowserURL: "/Applications/Brave.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "docs.google.com"}},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "docs.google.com", Path: "/document"}},
+				BrowserURL: "/Applications/Arc.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "docs.google.com", Path: "/document/d/personal"}},
+				BrowserURL: "/Applications/Opera.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "docs.google.com", Path: "/document/d/personal"}},
+				BrowserURL: "/Applications/Vivaldi.app",
+			},
+			{
+				Patterns:   []string{"mail.google.com"},
+				BrowserURL: "/Applications/Orion.app",
+				Priority:   1,
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Registrable domain beats substring", "https://google.com/", "/Applications/Edge.app"},
+		{"Wildcard host beats registrable domain", "https://maps.google.com/", "/Applications/Chrome.app"},
+		{"Longer wildcard beats shorter wildcard", "https://a.docs.google.com/", "/Applications/Brave.app"},
+		{"Exact host beats wildcard host", "https://docs.google.com/spreadsheets", "/Applications/Firefox.app"},
+		{"Path prefix beats host only", "https://docs.google.com/document/d/work", "/Applications/Arc.app"},
+		{"Longer path prefix beats shorter one", "https://docs.google.com/document/d/personal/1", "/Applications/Opera.app"},
+		{"Priority beats specificity", "https://mail.google.com/", "/Applications/Orion.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_MostSpecificMatch_TieBreak(t *testing.T) {
+	// Identical specificity and priority: the rule listed first wins, regardless of pattern order inside rules
+	testConfig := services.Config{
+		MatchMode: services.MatchModeSpecific,
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"nomatch", "example"},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				Patterns:   []string{"example"},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	for i := 0; i < 10; i++ {
+		if result := service.FindBrowserForURL("https://example.com"); result != "/Applications/Chrome.app" {
+			t.Fatalf("tie should resolve to the first rule, got %q", result)
+		}
+	}
+}
+
+func TestPatternService_ExcludePatterns(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:             []services.URLMatcher{{Host: "*.google.com"}},
+				ExcludeMatchers:      []services.URLMatcher{{Host: "docs.google.com", Path: "/personal"}},
+				ExcludePatterns:      []string{"authuser=1"},
+				ExcludeRegexPatterns: []string{"^https://mail\\.google\\.com/.*#spam"},
+				BrowserURL:           "/Applications/Chrome.app",
+			},
+			{
+				Patterns:   []string{"docs.google.com"},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+		},
+		DefaultBrowserURL: "/Applications/Safari.app",
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Rule matches without excludes", "https://docs.google.com/work", "/Applications/Chrome.app"},
+		{"Structured exclude falls through to later rule", "https://docs.google.com/personal/doc", "/Applications/Firefox.app"},
+		{"Pattern exclude falls through to no match", "https://maps.google.com/?authuser=1", ""},
+		{"Regex exclude falls through to no match", "https://mail.google.com/inbox#spam", ""},
+		{"Unrelated URL is unaffected", "https://mail.google.com/inbox", "/Applications/Chrome.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_ExcludedRuleDoesNotShadowLowerPriority(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"example.com"},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				Patterns:        []string{"example.com"},
+				ExcludePatterns: []string{"/private"},
+				BrowserURL:      "/Applications/Firefox.app",
+				Priority:        5,
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	if result := service.FindBrowserForURL("https://example.com/public"); result != "/Applications/Firefox.app" {
+		t.Errorf("expected higher priority rule, got %q", result)
+	}
+	if result := service.FindBrowserForURL("https://example.com/private"); result != "/Applications/Chrome.app" {
+		t.Errorf("excluded rule should fall through to the next match, got %q", result)
+	}
+}
+
+func TestPatternService_FindBrowserForRequest_SourceApps(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"github.com"},
+				SourceApps: []string{"com.apple.MobileSMS"},
+				BrowserURL: "/Applications/Safari.app",
+			},
+			{
+				SourceApps: []string{"com.tinyspeck.slackmacgap", "com.microsoft.teams2"},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				SourceApps: []string{"com.apple.MobileSMS"},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+			{
+				Patterns:   []string{"github.com"},
+				BrowserURL: "/Applications/Arc.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	tests := []struct {
+		name     string
+		request  services.URLRequest
+		expected string
+	}{
+		{"Condition-only rule matches any URL from Slack", services.URLRequest{URL: "https://example.com", SourceApp: "com.tinyspeck.slackmacgap"}, "/Applications/Chrome.app"},
+		{"Bundle identifier is case-insensitive", services.URLRequest{URL: "https://example.com", SourceApp: "COM.MICROSOFT.TEAMS2"}, "/Applications/Chrome.app"},
+		{"Pattern and source app must both match", services.URLRequest{URL: "https://github.com", SourceApp: "com.apple.MobileSMS"}, "/Applications/Safari.app"},
+		{"Source app without matching pattern falls through", services.URLRequest{URL: "https://example.com", SourceApp: "com.apple.MobileSMS"}, "/Applications/Firefox.app"},
+		{"Unknown source app skips conditional rules", services.URLRequest{URL: "https://github.com"}, "/Applications/Arc.app"},
+		{"Other source app skips conditional rules", services.URLRequest{URL: "https://example.com", SourceApp: "com.apple.mail"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.FindBrowserForRequest(tt.request)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForRequest(%+v) = %q, want %q", tt.request, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"testing"
+)
+
+func TestRewriteService_Rewrite(t *testing.T) {
+	rules := []services.RewriteRule{
+		{Find: "^http://", Replace: "https://"},
+		{Find: `^https://intranet\.old\.example\.com/`, Replace: "https://portal.example.com/"},
+		{Find: `^https://go/jira/(?P<key>[A-Z]+-\d+)$`, Template: "https://jira.example.com/browse/{{.Named.key}}"},
+		{Find: `^https://search\.example\.com/`, Template: "https://{{.Hostname}}/find?q={{queryEscape (index .Query.q 0)}}&src=brb"},
+	}
+	service := services.NewRewriteService(rules)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		rules    []int
+	}{
+		{"Upgrades http to https", "http://example.com/a", "https://example.com/a", []int{0}},
+		{"Chains rules in order", "http://intranet.old.example.com/page", "https://portal.example.com/page", []int{0, 1}},
+		{"Expands short link with named group template", "http://go/jira/ABC-123", "https://jira.example.com/browse/ABC-123", []int{0, 2}},
+		{"Template can use parsed URL parts", "https://search.example.com/?q=a b", "https://search.example.com/find?q=a+b&src=brb", []int{3}},
+		{"Leaves unmatched URLs untouched", "https://github.com", "https://github.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, applied, err := service.Rewrite(tt.url)
+			if err != nil {
+				t.Fatalf("Rewrite(%q) returned error: %v", tt.url, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+			var ruleIndexes []int
+			for _, a := range applied {
+				ruleIndexes = append(ruleIndexes, a.Rule)
+			}
+			if len(ruleIndexes) != len(tt.rules) {
+				t.Fatalf("applied rules = %v, want %v", ruleIndexes, tt.rules)
+			}
+			for i := range ruleIndexes {
+				if ruleIndexes[i] != tt.rules[i] {
+					t.Errorf("applied rules = %v, want %v", ruleIndexes, tt.rules)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteService_LoopSafety(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []services.RewriteRule
+	}{
+		{
+			name: "Two rules undoing each other",
+			rules: []services.RewriteRule{
+				{Find: "^https://a\\.example\\.com", Replace: "https://b.example.com"},
+				{Find: "^https://b\\.example\\.com", Replace: "https://a.example.com"},
+			},
+		},
+		{
+			name: "Rule that keeps growing the URL",
+			rules: []services.RewriteRule{
+				{Find: "^https://", Replace: "https://www."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := services.NewRewriteService(tt.rules)
+			result, _, err := service.Rewrite("https://a.example.com/")
+			if !errors.Is(err, services.ErrRewriteLoop) {
+				t.Fatalf("expected ErrRewriteLoop, got %v", err)
+			}
+			if result != "https://a.example.com/" {
+				t.Errorf("looping rewrites should return the original URL, got %q", result)
+			}
+		})
+	}
+}
+
+func TestRewriteService_InvalidRuleSkipped(t *testing.T) {
+	service := services.NewRewriteService([]services.RewriteRule{
+		{Find: "[invalid", Replace: "x"},
+		{Find: "^http://", Replace: "https://"},
+	})
+
+	result, applied, err := service.Rewrite("http://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "https://example.com" {
+		t.Errorf("valid rule should still apply, got %q", result)
+	}
+	if len(applied) != 1 || applied[0].Rule != 1 {
+		t.Errorf("applied = %+v, want rule 1 only", applied)
+	}
+}
+
+// failingStage is a URLStage that always fails
+type failingStage struct{}
+
+func (failingStage) Name() string { return "failing" }
+
+func (failingStage) Process(string) (string, error) { return "", errors.New("boom") }
+
+func TestURLPipeline_Process(t *testing.T) {
+	rewrites := services.NewRewriteService([]services.RewriteRule{{Find: "^http://", Replace: "https://"}})
+	pipeline := services.NewURLPipeline(failingStage{}, rewrites)
+
+	result, stages := pipeline.Process("http://example.com")
+	if result != "https://example.com" {
+		t.Errorf("Process() = %q, want %q", result, "https://example.com")
+	}
+	if len(stages) != 2 {
+		t.Fatalf("expected 2 stage results, got %d", len(stages))
+	}
+	if stages[0].Err == nil || stages[0].Output != "http://example.com" {
+		t.Errorf("failed stage should pass its input through, got %+v", stages[0])
+	}
+	if !stages[1].Changed() || stages[1].Stage != "rewrite" {
+		t.Errorf("rewrite stage result = %+v", stages[1])
+	}
+}
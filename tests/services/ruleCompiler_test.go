@@ -0,0 +1,124 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileRules_AggregatesErrors(t *testing.T) {
+	config := services.Config{
+		MatchMode:  "best",
+		AskTimeout: "soon",
+		Browsers: []services.BrowserConfig{
+			{Patterns: []string{"github.com"}, BrowserURL: "/Applications/Chrome.app", Open: "every"},
+			{RegexPatterns: []string{`^https://ok\.example\.com`, "[invalid regex["}, BrowserURL: "/Applications/Firefox.app"},
+			{
+				Matchers:             []services.URLMatcher{{Host: "a.*.example.com"}, {Port: "99999"}},
+				ExcludeRegexPatterns: []string{"(unclosed"},
+				BrowserURL:           "/Applications/Safari.app",
+			},
+			{Patterns: []string{"x"}, Schedule: &services.Schedule{Weekdays: []string{"someday"}}},
+		},
+		Rewrites: []services.RewriteRule{{Find: "*bad"}},
+		Wrappers: []services.WrapperRule{{Host: "google.*", Param: ""}},
+	}
+
+	_, err := services.CompileRules(config)
+	var configErrs services.ConfigErrors
+	if !errors.As(err, &configErrs) {
+		t.Fatalf("expected ConfigErrors, got %v", err)
+	}
+
+	expected := []struct {
+		section string
+		index   int
+		field   string
+		pattern string
+		reason  string
+	}{
+		{"matchMode", -1, "", "", `unknown match mode "best"`},
+		{"askTimeout", -1, "", "soon", "invalid duration"},
+		{"browsers", 0, "open", "", `unknown open mode "every"`},
+		{"browsers", 1, "regexPatterns[1]", "[invalid regex[", "missing closing ]"},
+		{"browsers", 2, "matchers[0]", "", "wildcard"},
+		{"browsers", 2, "matchers[1]", "", `port "99999"`},
+		{"browsers", 2, "excludeRegexPatterns[0]", "(unclosed", "missing closing )"},
+		{"browsers", 3, "schedule", "", `unknown weekday "someday"`},
+		{"rewrites", 0, "", "", "invalid find pattern"},
+		{"wrappers", 0, "param", "", "query parameter is required"},
+	}
+	if len(configErrs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d:\n%v", len(expected), len(configErrs), err)
+	}
+	for i, want := range expected {
+		got := configErrs[i]
+		if got.Section != want.section || got.Index != want.index || got.Field != want.field || got.Pattern != want.pattern {
+			t.Errorf("error %d at %s[%d].%s %q, want %s[%d].%s %q", i, got.Section, got.Index, got.Field, got.Pattern, want.section, want.index, want.field, want.pattern)
+		}
+		if !strings.Contains(got.Error(), want.reason) {
+			t.Errorf("error %d = %q, want it to mention %q", i, got.Error(), want.reason)
+		}
+	}
+
+	message := err.Error()
+	if !strings.HasPrefix(message, "10 invalid config entries:") || !strings.Contains(message, `browsers[1].regexPatterns[1] "[invalid regex["`) {
+		t.Errorf("unexpected aggregated message:\n%s", message)
+	}
+}
+
+func TestCompileRules_ValidRulesStillMatch(t *testing.T) {
+	rules, err := services.CompileRules(services.Config{
+		Browsers: []services.BrowserConfig{
+			{RegexPatterns: []string{"[invalid", `github\.com`}, BrowserURL: "/Applications/Chrome.app"},
+			{Patterns: []string{"example.com"}, Schedule: &services.Schedule{TimeZone: "Mars/Olympus"}, BrowserURL: "/Applications/Firefox.app"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected errors for the invalid regex and time zone")
+	}
+
+	service := services.NewPatternServiceWithRules(rules)
+	if result := service.FindBrowserForURL("https://github.com/"); result != "/Applications/Chrome.app" {
+		t.Errorf("valid regex of a rule with an invalid one should still match, got %q", result)
+	}
+	if result := service.FindBrowserForURL("https://example.com/"); result != "" {
+		t.Errorf("rule with an invalid schedule must never match, got %q", result)
+	}
+}
+
+func TestCompileRules_DefaultApps(t *testing.T) {
+	_, err := services.CompileRules(services.Config{
+		DefaultApps: map[string]string{"mailto": "/System/Applications/Mail.app", "1tel": "/x.app"},
+	})
+	var configErrs services.ConfigErrors
+	if !errors.As(err, &configErrs) || len(configErrs) != 1 || configErrs[0].Field != "1tel" {
+		t.Errorf("expected one error for the invalid scheme, got %v", err)
+	}
+}
+
+func TestCompileRules_ValidConfig(t *testing.T) {
+	rules, err := services.CompileRules(services.Config{
+		MatchMode:  services.MatchModeSpecific,
+		AskTimeout: "90s",
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:      []string{"github.com"},
+				RegexPatterns: []string{`^https://.*\.example\.com/`},
+				Matchers:      []services.URLMatcher{{Host: "*.example.com", Port: "8000-8999", Path: "/api/*"}},
+				Network:       &services.NetworkCondition{CIDRs: []string{"10.0.0.0/8"}},
+				BrowserURL:    "/Applications/Chrome.app",
+			},
+		},
+		Wrappers:   []services.WrapperRule{{Host: "google.*", Path: "/url", Param: "q"}},
+		Shorteners: &services.ShortenerConfig{Hosts: []string{"bit.ly", "*.short.example.com"}},
+	})
+	if err != nil {
+		t.Errorf("valid config reported errors: %v", err)
+	}
+	if rules.AskTimeout() != 90*time.Second {
+		t.Errorf("AskTimeout() = %v, want 90s", rules.AskTimeout())
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// linearMatcher is the straightforward first-match scan over every rule, used as the
+// reference for the indexed PatternService and as the baseline in benchmarks
+type linearMatcher struct {
+	config  services.Config
+	regexes map[string]*regexp.Regexp
+}
+
+func newLinearMatcher(config services.Config) *linearMatcher {
+	lm := &linearMatcher{config: config, regexes: make(map[string]*regexp.Regexp)}
+	for _, rule := range config.Browsers {
+		for _, pattern := range rule.RegexPatterns {
+			lm.regexes[pattern] = regexp.MustCompile(pattern)
+		}
+	}
+	return lm
+}
+
+func (lm *linearMatcher) find(rawURL string) string {
+	urlLower := strings.ToLower(rawURL)
+	parsed, _ := url.Parse(rawURL)
+	for _, rule := range lm.config.Browsers {
+		for _, pattern := range rule.Patterns {
+			if strings.Contains(urlLower, strings.ToLower(pattern)) {
+				return rule.BrowserURL
+			}
+		}
+		for _, pattern := range rule.RegexPatterns {
+			if lm.regexes[pattern].MatchString(rawURL) {
+				return rule.BrowserURL
+			}
+		}
+		for _, matcher := range rule.Matchers {
+			if parsed != nil && linearHostMatches(matcher, strings.ToLower(parsed.Hostname())) {
+				return rule.BrowserURL
+			}
+		}
+	}
+	return ""
+}
+
+// linearHostMatches supports the host and domain matchers generated by indexTestConfig
+func linearHostMatches(matcher services.URLMatcher, host string) bool {
+	if matcher.Domain != "" {
+		registrable, err := publicsuffix.EffectiveTLDPlusOne(host)
+		return err == nil && registrable == matcher.Domain
+	}
+	if suffix, ok := strings.CutPrefix(matcher.Host, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == matcher.Host
+}
+
+// indexTestConfig generates n rules mixing substring patterns, regexes with and without
+// literals, and host, wildcard and domain matchers
+func indexTestConfig(n int) services.Config {
+	config := services.Config{}
+	for i := 0; i < n; i++ {
+		rule := services.BrowserConfig{BrowserURL: fmt.Sprintf("/Applications/Browser%d.app", i)}
+		switch i % 6 {
+		case 0, 1:
+			rule.Patterns = []string{fmt.Sprintf("Team%d.example.com", i)}
+		case 2:
+			rule.RegexPatterns = []string{fmt.Sprintf(`^https://svc%d\.internal\.example\.net/`, i)}
+		case 3:
+			rule.Matchers = []services.URLMatcher{{Host: fmt.Sprintf("*.proj%d.example.org", i)}}
+		case 4:
+			rule.Matchers = []services.URLMatcher{{Domain: fmt.Sprintf("site%d.com", i)}}
+		case 5:
+			rule.Matchers = []services.URLMatcher{{Host: fmt.Sprintf("host%d.example.io", i)}}
+		}
+		config.Browsers = append(config.Browsers, rule)
+	}
+	return config
+}
+
+// indexTestURLs returns URLs that hit rules at the start, middle and end of the config, and misses
+func indexTestURLs(n int) []string {
+	last := n - 1
+	return []string{
+		"https://team0.example.com/x",
+		fmt.Sprintf("https://TEAM%d.EXAMPLE.COM/page", (n/2)/6*6),
+		fmt.Sprintf("https://svc%d.internal.example.net/api", last/6*6+2),
+		fmt.Sprintf("https://a.b.proj%d.example.org/", (n/3)/6*6+3),
+		fmt.Sprintf("https://www.site%d.com/", last/6*6+4),
+		fmt.Sprintf("https://host%d.example.io/", (n/4)/6*6+5),
+		fmt.Sprintf("https://proj%d.example.org/", 3),
+		"https://github.com/org/repo?q=team",
+		"https://nothing.example.com/matches/here",
+		"mailto:someone@example.com",
+	}
+}
+
+func TestPatternService_IndexMatchesLinearScan(t *testing.T) {
+	config := indexTestConfig(600)
+	config.Browsers = append(config.Browsers,
+		services.BrowserConfig{RegexPatterns: []string{`^https?://[a-z]+\d{3}\.test/`}, BrowserURL: "/Applications/NoLiteral.app"},
+		services.BrowserConfig{RegexPatterns: []string{`(?i)CaseFolded\.Example`}, BrowserURL: "/Applications/Folded.app"},
+		services.BrowserConfig{Patterns: []string{"hers", "she"}, BrowserURL: "/Applications/Overlap1.app"},
+		services.BrowserConfig{Patterns: []string{"he"}, BrowserURL: "/Applications/Overlap2.app"},
+	)
+	service := services.NewPatternService(config)
+	reference := newLinearMatcher(config)
+
+	urls := append(indexTestURLs(600),
+		"http://abc123.test/",
+		"https://www.casefolded.example/",
+		"https://ushers.example/",
+		"https://the.example/",
+	)
+	for _, rawURL := range urls {
+		if got, want := service.FindBrowserForURL(rawURL), reference.find(rawURL); got != want {
+			t.Errorf("FindBrowserForURL(%q) = %q, linear scan gives %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestPatternService_IndexKeepsConfigOrder(t *testing.T) {
+	service := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Matchers: []services.URLMatcher{{Domain: "example.com"}}, BrowserURL: "/Applications/Domain.app"},
+			{Patterns: []string{"docs.example.com"}, BrowserURL: "/Applications/Pattern.app"},
+			{RegexPatterns: []string{`docs\.example\.com/guide`}, BrowserURL: "/Applications/Regex.app"},
+			{SourceApps: []string{"com.tinyspeck.slackmacgap"}, BrowserURL: "/Applications/Slack Links.app"},
+		},
+	})
+
+	if result := service.FindBrowserForURL("https://docs.example.com/guide"); result != "/Applications/Domain.app" {
+		t.Errorf("first rule in config order should win, got %q", result)
+	}
+	request := services.URLRequest{URL: "https://other.example.org/", SourceApp: "com.tinyspeck.slackmacgap"}
+	if result := service.FindBrowserForRequest(request); result != "/Applications/Slack Links.app" {
+		t.Errorf("condition-only rule should still be considered, got %q", result)
+	}
+}
+
+func benchmarkURLs(b *testing.B, find func(string) string) {
+	urls := indexTestURLs(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		find(urls[i%len(urls)])
+	}
+}
+
+func BenchmarkFindBrowserForURL_10kRules_Indexed(b *testing.B) {
+	service := services.NewPatternService(indexTestConfig(10000))
+	benchmarkURLs(b, service.FindBrowserForURL)
+}
+
+func BenchmarkFindBrowserForURL_10kRules_LinearScan(b *testing.B) {
+	reference := newLinearMatcher(indexTestConfig(10000))
+	benchmarkURLs(b, reference.find)
+}
+
+func BenchmarkCompileRules_10kRules(b *testing.B) {
+	config := indexTestConfig(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := services.CompileRules(config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock that always returns the same time
+type fixedClock struct {
+	now time.Time
+}
+
+// Now implements Clock interface
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestPatternService_ScheduleConditions(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns: []string{"youtube.com"},
+				Schedule: &services.Schedule{
+					Weekdays: []string{"mon-fri"},
+					Hours:    []services.TimeWindow{{Start: "09:00", End: "17:30"}},
+					TimeZone: "Europe/Amsterdam",
+				},
+				BrowserURL: "/Applications/Work Browser.app",
+			},
+			{
+				Patterns: []string{"news.example.com"},
+				Schedule: &services.Schedule{
+					Hours: []services.TimeWindow{{Start: "22:00", End: "06:00"}},
+				},
+				BrowserURL: "/Applications/Night Browser.app",
+			},
+			{
+				Schedule: &services.Schedule{
+					Weekdays: []string{"sat", "Sunday"},
+				},
+				BrowserURL: "/Applications/Weekend Browser.app",
+			},
+			{
+				Patterns:   []string{"youtube.com"},
+				BrowserURL: "/Applications/Personal Browser.app",
+			},
+		},
+	}
+
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		url      string
+		expected string
+	}{
+		{"Weekday during work hours", time.Date(2024, 3, 4, 10, 0, 0, 0, amsterdam), "https://youtube.com", "/Applications/Work Browser.app"},
+		{"Window end is exclusive", time.Date(2024, 3, 4, 17, 30, 0, 0, amsterdam), "https://youtube.com", "/Applications/Personal Browser.app"},
+		{"Weekday before work hours", time.Date(2024, 3, 4, 8, 59, 0, 0, amsterdam), "https://youtube.com", "/Applications/Personal Browser.app"},
+		{"Time zone is applied to the clock", time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC), "https://youtube.com", "/Applications/Work Browser.app"},
+		{"Weekend-only rule matches every URL on Saturday", time.Date(2024, 3, 9, 12, 0, 0, 0, amsterdam), "https://youtube.com", "/Applications/Weekend Browser.app"},
+		{"Weekend-only rule does not match on Monday", time.Date(2024, 3, 4, 12, 0, 0, 0, amsterdam), "https://example.com", ""},
+		{"Window wrapping midnight, late evening", time.Date(2024, 3, 5, 23, 0, 0, 0, time.Local), "https://news.example.com", "/Applications/Night Browser.app"},
+		{"Window wrapping midnight, early morning", time.Date(2024, 3, 5, 5, 59, 0, 0, time.Local), "https://news.example.com", "/Applications/Night Browser.app"},
+		{"Window wrapping midnight, daytime", time.Date(2024, 3, 5, 12, 0, 0, 0, time.Local), "https://news.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := services.NewPatternService(testConfig)
+			service.SetClock(fixedClock{now: tt.now})
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) at %v = %q, want %q", tt.url, tt.now, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_ScheduleInvalidTimeZone(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"example.com"},
+				Schedule:   &services.Schedule{TimeZone: "Mars/Olympus_Mons"},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+	service.SetClock(fixedClock{now: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)})
+
+	if result := service.FindBrowserForURL("https://example.com"); result != "" {
+		t.Errorf("rule with an unknown time zone should never be active, got %q", result)
+	}
+}
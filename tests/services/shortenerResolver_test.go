@@ -0,0 +1,158 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newShortenerServer starts a fake shortener and counts the requests it receives
+func newShortenerServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func shortenerConfig(timeoutMs int) *services.ShortenerConfig {
+	return &services.ShortenerConfig{Hosts: []string{"127.0.0.1"}, TimeoutMs: timeoutMs, MaxHops: 3}
+}
+
+func TestShortenerResolver_FollowsRedirects(t *testing.T) {
+	var methods []string
+	server, _ := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch r.URL.Path {
+		case "/abc":
+			http.Redirect(w, r, "/def", http.StatusFound)
+		case "/def":
+			http.Redirect(w, r, "https://example.com/final?x=1", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	resolver := services.NewShortenerResolverWithClient(shortenerConfig(1000), server.Client())
+
+	result, err := resolver.Resolve(server.URL + "/abc")
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if result != "https://example.com/final?x=1" {
+		t.Errorf("Resolve() = %q, want the final destination", result)
+	}
+	if len(methods) != 2 || methods[0] != http.MethodHead || methods[1] != http.MethodHead {
+		t.Errorf("expected two HEAD requests, got %v", methods)
+	}
+}
+
+func TestShortenerResolver_FallsBackToGET(t *testing.T) {
+	server, _ := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(w, r, "https://example.com/from-get", http.StatusFound)
+	})
+	resolver := services.NewShortenerResolverWithClient(shortenerConfig(1000), server.Client())
+
+	result, err := resolver.Resolve(server.URL + "/x")
+	if err != nil || result != "https://example.com/from-get" {
+		t.Errorf("Resolve() = %q, %v; want GET fallback destination", result, err)
+	}
+}
+
+func TestShortenerResolver_MaxHops(t *testing.T) {
+	server, _ := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	resolver := services.NewShortenerResolverWithClient(shortenerConfig(1000), server.Client())
+
+	original := server.URL + "/loop"
+	result, err := resolver.Resolve(original)
+	if !errors.Is(err, services.ErrTooManyRedirects) {
+		t.Fatalf("expected ErrTooManyRedirects, got %v", err)
+	}
+	if result != original {
+		t.Errorf("failed resolution should return the original URL, got %q", result)
+	}
+}
+
+func TestShortenerResolver_Timeout(t *testing.T) {
+	server, _ := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		http.Redirect(w, r, "https://example.com/late", http.StatusFound)
+	})
+	resolver := services.NewShortenerResolverWithClient(shortenerConfig(50), server.Client())
+
+	original := server.URL + "/slow"
+	start := time.Now()
+	result, err := resolver.Resolve(original)
+	if err == nil {
+		t.Fatalf("expected a timeout error, got %q", result)
+	}
+	if result != original {
+		t.Errorf("timed out resolution should return the original URL, got %q", result)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout not enforced, took %v", elapsed)
+	}
+}
+
+func TestShortenerResolver_CacheAndPassThrough(t *testing.T) {
+	server, hits := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/landing" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "https://example.com/cached", http.StatusFound)
+	})
+	resolver := services.NewShortenerResolverWithClient(shortenerConfig(1000), server.Client())
+
+	for i := 0; i < 3; i++ {
+		if result, _ := resolver.Resolve(server.URL + "/c"); result != "https://example.com/cached" {
+			t.Fatalf("Resolve() = %q", result)
+		}
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("expected 1 request thanks to the cache, got %d", got)
+	}
+
+	// A shortener page that does not redirect is left as is
+	if result, err := resolver.Resolve(server.URL + "/landing"); err != nil || result != server.URL+"/landing" {
+		t.Errorf("non-redirect response should keep the URL, got %q, %v", result, err)
+	}
+
+	// Other hosts are never contacted
+	before := atomic.LoadInt32(hits)
+	if result, _ := resolver.Resolve("https://example.com/page"); result != "https://example.com/page" {
+		t.Errorf("non-shortener URL changed to %q", result)
+	}
+	if atomic.LoadInt32(hits) != before {
+		t.Errorf("non-shortener URL should not cause a request")
+	}
+}
+
+func TestShortenerResolver_DisabledWithoutHosts(t *testing.T) {
+	server, hits := newShortenerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusFound)
+	})
+	resolver := services.NewShortenerResolverWithClient(nil, server.Client())
+
+	if result, _ := resolver.Resolve(server.URL + "/a"); result != server.URL+"/a" {
+		t.Errorf("resolver without config should not expand, got %q", result)
+	}
+	if atomic.LoadInt32(hits) != 0 {
+		t.Errorf("resolver without config should not make requests")
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const rulePack = `{
+  "browsers": [{ "patterns": ["intranet.example.com"], "browserURL": "/Applications/Google Chrome.app" }],
+  "defaultBrowserURL": "/Applications/Arc.app"
+}`
+
+// packServer serves a rule pack with an ETag and counts the requests for it
+type packServer struct {
+	mu          sync.Mutex
+	pack        string
+	signature   string
+	requests    int
+	notModified int
+}
+
+func (ps *packServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if r.URL.Path == "/pack.json.sig" {
+		_, _ = w.Write([]byte(ps.signature))
+		return
+	}
+	ps.requests++
+	sum := sha256.Sum256([]byte(ps.pack))
+	etag := `"` + hex.EncodeToString(sum[:4]) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		ps.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write([]byte(ps.pack))
+}
+
+// newSubscribedConfigService writes a config subscribing to the rule pack of a test server
+func newSubscribedConfigService(t *testing.T, server *httptest.Server, subscription string) *services.ConfigService {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+  "browsers": [{ "patterns": ["github.com"], "browserURL": "/Applications/Firefox.app" }],
+  "defaultBrowserURL": "/Applications/Safari.app",
+  "subscriptions": [{ "url": "` + server.URL + `/pack.json"` + subscription + ` }]
+}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service, err := services.NewConfigServiceWithPath(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	service.SetHTTPClient(server.Client())
+	return service
+}
+
+func TestConfigService_SyncSubscriptions(t *testing.T) {
+	packs := &packServer{pack: rulePack}
+	server := httptest.NewTLSServer(packs)
+	defer server.Close()
+
+	service := newSubscribedConfigService(t, server, `, "refreshMinutes": 60`)
+	clock := &movableClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	service.SetClock(clock)
+
+	if statuses := service.Subscriptions(); len(statuses) != 1 || !statuses[0].SyncedAt.IsZero() || statuses[0].Cached {
+		t.Fatalf("a new subscription should not be synced yet, got %+v", statuses)
+	}
+	changed, err := service.SyncSubscriptions(false)
+	if err != nil || !changed {
+		t.Fatalf("first sync = %v, %v; want a changed pack", changed, err)
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	config := service.GetConfig()
+	if len(config.Browsers) != 2 || config.Browsers[1].Patterns[0] != "intranet.example.com" {
+		t.Errorf("the pack's rules should be merged after the local ones, got %+v", config.Browsers)
+	}
+	if config.DefaultBrowserURL != "/Applications/Safari.app" {
+		t.Errorf("local settings should win over the pack, got %s", config.DefaultBrowserURL)
+	}
+	if statuses := service.Subscriptions(); !statuses[0].SyncedAt.Equal(clock.now) || !statuses[0].Cached || statuses[0].Err != "" {
+		t.Errorf("status after sync = %+v", statuses[0])
+	}
+
+	// Not due yet: no request is made
+	clock.now = clock.now.Add(30 * time.Minute)
+	if changed, err := service.SyncSubscriptions(false); changed || err != nil || packs.requests != 1 {
+		t.Errorf("sync before refreshMinutes = %v, %v with %d requests; want no request", changed, err, packs.requests)
+	}
+
+	// Due: the server confirms the cached copy with 304 Not Modified
+	clock.now = clock.now.Add(time.Hour)
+	if changed, err := service.SyncSubscriptions(false); changed || err != nil || packs.notModified != 1 {
+		t.Errorf("sync of an unchanged pack = %v, %v with %d not modified responses", changed, err, packs.notModified)
+	}
+	if statuses := service.Subscriptions(); !statuses[0].SyncedAt.Equal(clock.now) {
+		t.Errorf("a not modified response should count as synced, got %v", statuses[0].SyncedAt)
+	}
+
+	// A new version is downloaded when forced
+	packs.mu.Lock()
+	packs.pack = strings.Replace(rulePack, "intranet.example.com", "wiki.example.com", 1)
+	packs.mu.Unlock()
+	if changed, err := service.SyncSubscriptions(true); !changed || err != nil {
+		t.Errorf("forced sync of a new version = %v, %v", changed, err)
+	}
+
+	// Offline: the cached copy stays in use and the error is reported
+	server.Close()
+	clock.now = clock.now.Add(2 * time.Hour)
+	if _, err := service.SyncSubscriptions(false); err == nil {
+		t.Errorf("sync without a server should fail")
+	}
+	if err := service.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if browsers := service.GetConfig().Browsers; len(browsers) != 2 || browsers[1].Patterns[0] != "wiki.example.com" {
+		t.Errorf("the cached pack should be used offline, got %+v", browsers)
+	}
+	if status := service.Subscriptions()[0]; status.Err == "" || status.SyncedAt.Equal(clock.now) || !status.Cached {
+		t.Errorf("status after a failed sync = %+v", status)
+	}
+}
+
+func TestConfigService_SubscriptionVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(rulePack))
+	otherSum := sha256.Sum256([]byte("{}"))
+	key := base64.StdEncoding.EncodeToString(publicKey)
+
+	tests := []struct {
+		name         string
+		subscription string
+		signature    []byte
+		wantErr      string
+	}{
+		{"matching checksum", `, "sha256": "` + hex.EncodeToString(sum[:]) + `"`, nil, ""},
+		{"checksum mismatch", `, "sha256": "` + hex.EncodeToString(otherSum[:]) + `"`, nil, "checksum mismatch"},
+		{"valid signature", `, "publicKey": "` + key + `"`, ed25519.Sign(privateKey, []byte(rulePack)), ""},
+		{"signature of other content", `, "publicKey": "` + key + `"`, ed25519.Sign(privateKey, []byte("{}")), "signature does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(&packServer{pack: rulePack, signature: base64.StdEncoding.EncodeToString(tt.signature)})
+			defer server.Close()
+			service := newSubscribedConfigService(t, server, tt.subscription)
+
+			changed, err := service.SyncSubscriptions(true)
+			if tt.wantErr == "" {
+				if err != nil || !changed {
+					t.Errorf("SyncSubscriptions() = %v, %v; want the pack", changed, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || changed {
+				t.Errorf("SyncSubscriptions() = %v, %v; want error containing %q", changed, err, tt.wantErr)
+			}
+			if status := service.Subscriptions()[0]; status.Cached {
+				t.Errorf("a rejected pack should not be cached")
+			}
+		})
+	}
+}
+
+func TestCompileRules_SubscriptionErrors(t *testing.T) {
+	config := services.Config{Subscriptions: []services.Subscription{
+		{URL: "https://rules.example.com/brb.json"},
+		{URL: "http://rules.example.com/brb.json", SHA256: "abc", PublicKey: "not a key"},
+	}}
+	_, err := services.CompileRules(config)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{`subscriptions[1].url`, `subscriptions[1].sha256 "abc"`, `subscriptions[1].publicKey`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "subscriptions[0]") {
+		t.Errorf("a valid subscription should not be reported: %v", err)
+	}
+}
+
+func TestConfigService_SyncDuringEdits(t *testing.T) {
+	server := httptest.NewTLSServer(&packServer{pack: rulePack})
+	defer server.Close()
+	service := newSubscribedConfigService(t, server, "")
+
+	// Background syncs and reloads run while the menu edits the config
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.RunSubscriptions(time.Millisecond, stop, func(changed bool, err error) {
+			_ = service.Load()
+			service.GetConfigAndRules()
+		})
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := service.AddLearnedRule("https://news.example.org/", "/Applications/Safari.app", ""); err != nil {
+			t.Errorf("AddLearnedRule failed: %v", err)
+		}
+		if err := service.SetDefaultBrowser("/Applications/Arc.app"); err != nil {
+			t.Errorf("SetDefaultBrowser failed: %v", err)
+		}
+		service.Subscriptions()
+		service.GetConfig()
+		if _, err := service.SyncSubscriptions(true); err != nil {
+			t.Errorf("SyncSubscriptions failed: %v", err)
+		}
+	}
+	close(stop)
+	<-done
+
+	if learned := service.LearnedRules(); len(learned) != 1 {
+		t.Errorf("expected 1 learned rule, got %+v", learned)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"net/url"
+	"testing"
+)
+
+func TestUnwrapService_BuiltinWrappers(t *testing.T) {
+	service := services.NewUnwrapService(nil)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			"Outlook SafeLinks",
+			"https://eur01.safelinks.protection.outlook.com/?url=https%3A%2F%2Fgithub.com%2Forg%2Frepo&data=05%7C01&reserved=0",
+			"https://github.com/org/repo",
+		},
+		{"Google redirect with q", "https://www.google.com/url?q=https://example.com/page&sa=D", "https://example.com/page"},
+		{"Google redirect on a country domain", "https://www.google.co.uk/url?url=https%3A%2F%2Fexample.com%2F", "https://example.com/"},
+		{"Slack redirect", "https://slack-redir.net/link?url=https%3A%2F%2Fexample.com%2Fdoc", "https://example.com/doc"},
+		{"LinkedIn redirect", "https://www.linkedin.com/redir/redirect?url=https%3A%2F%2Fexample.com&urlhash=abc", "https://example.com"},
+		{"LinkedIn safety page", "https://www.linkedin.com/safety/go?url=https%3A%2F%2Fexample.com%2Fjob", "https://example.com/job"},
+		{"Facebook l.php", "https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F%3Fa%3D1&h=AT0", "https://example.com/?a=1"},
+		{"AMP cache over https", "https://example-com.cdn.ampproject.org/c/s/example.com/news/story?x=1", "https://example.com/news/story?x=1"},
+		{"AMP cache over http", "https://example-com.cdn.ampproject.org/c/example.com/news", "http://example.com/news"},
+		{"Google AMP viewer", "https://www.google.com/amp/s/example.com/amp/article", "https://example.com/amp/article"},
+		{"Nested wrappers", "https://www.google.com/url?q=" + url.QueryEscape("https://l.facebook.com/l.php?u="+url.QueryEscape("https://example.com/deep")), "https://example.com/deep"},
+		{"Google search is not a redirect", "https://www.google.com/search?q=https://example.com", "https://www.google.com/search?q=https://example.com"},
+		{"Lookalike host is not unwrapped", "https://www.google.evil.com/url?q=https://example.com", "https://www.google.evil.com/url?q=https://example.com"},
+		{"Non-web destination is not unwrapped", "https://l.facebook.com/l.php?u=javascript:alert(1)", "https://l.facebook.com/l.php?u=javascript:alert(1)"},
+		{"Plain URL is untouched", "https://github.com/", "https://github.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.Unwrap(tt.url)
+			if result != tt.expected {
+				t.Errorf("Unwrap(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnwrapService_ConfiguredWrappers(t *testing.T) {
+	service := services.NewUnwrapService([]services.WrapperRule{
+		{Host: "*.mailtrack.example.com", Path: "/click", Param: "target"},
+	})
+
+	result := service.Unwrap("https://eu.mailtrack.example.com/click?id=1&target=https%3A%2F%2Fexample.org%2F")
+	if result != "https://example.org/" {
+		t.Errorf("configured wrapper not unwrapped, got %q", result)
+	}
+
+	// Built-in wrappers keep working alongside configured ones
+	result = service.Unwrap("https://slack-redir.net/link?url=https%3A%2F%2Fexample.org%2F")
+	if result != "https://example.org/" {
+		t.Errorf("built-in wrapper not unwrapped, got %q", result)
+	}
+}
+
+// prefixUnwrapper is a custom URLUnwrapper for paths like /go/<escaped URL>
+type prefixUnwrapper struct{}
+
+func (prefixUnwrapper) Unwrap(u *url.URL) (string, bool) {
+	if u.Host != "redirect.test" || len(u.Path) < 4 {
+		return "", false
+	}
+	return u.Path[4:], true
+}
+
+func TestUnwrapService_CustomUnwrapperAndMatching(t *testing.T) {
+	service := services.NewUnwrapServiceWithUnwrappers(prefixUnwrapper{})
+	pipeline := services.NewURLPipeline(service)
+	patternService := services.NewPatternService(services.Config{
+		Browsers: []services.BrowserConfig{
+			{Matchers: []services.URLMatcher{{Host: "github.com"}}, BrowserURL: "/Applications/Chrome.app"},
+		},
+	})
+
+	unwrapped, _ := pipeline.Process("https://redirect.test/go/https://github.com/org")
+	if unwrapped != "https://github.com/org" {
+		t.Fatalf("Process() = %q", unwrapped)
+	}
+	if result := patternService.FindBrowserForURL(unwrapped); result != "/Applications/Chrome.app" {
+		t.Errorf("rules should match the unwrapped destination, got %q", result)
+	}
+}
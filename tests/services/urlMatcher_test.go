@@ -0,0 +1,115 @@
+package services
+
+import (
+	"browserRedirectBar/src/services"
+	"testing"
+)
+
+func TestPatternService_FindBrowserForURL_StructuredMatchers(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:   []services.URLMatcher{{Host: "github.com"}},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "*.atlassian.net", Path: "/wiki"}},
+				BrowserURL: "/Applications/Firefox.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Domain: "google.co.uk"}},
+				BrowserURL: "/Applications/Arc.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Scheme: "http", Host: "localhost", Port: "3000-3999"}},
+				BrowserURL: "/Applications/Brave.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "example.com", Path: "/docs/*/edit"}},
+				BrowserURL: "/Applications/Edge.app",
+			},
+			{
+				Matchers:   []services.URLMatcher{{Host: "example.com", Query: map[string]string{"account": "work", "debug": ""}}},
+				BrowserURL: "/Applications/Opera.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Exact host matches", "https://github.com/user/repo", "/Applications/Chrome.app"},
+		{"Exact host is case-insensitive", "https://GitHub.COM./user", "/Applications/Chrome.app"},
+		{"Host in query string does not match", "https://evil.io/?next=github.com", ""},
+		{"Host suffix does not match", "https://notgithub.com", ""},
+		{"Subdomain does not match exact host", "https://gist.github.com", ""},
+		{"Wildcard host with path prefix", "https://team.atlassian.net/wiki/spaces", "/Applications/Firefox.app"},
+		{"Wildcard host does not match apex", "https://atlassian.net/wiki", ""},
+		{"Wildcard host with wrong path", "https://team.atlassian.net/jira", ""},
+		{"Registrable domain matches subdomain", "https://mail.google.co.uk", "/Applications/Arc.app"},
+		{"Registrable domain matches apex", "https://google.co.uk", "/Applications/Arc.app"},
+		{"Public suffix is not the registrable domain", "https://co.uk", ""},
+		{"Port inside range", "http://localhost:3001", "/Applications/Brave.app"},
+		{"Port outside range", "http://localhost:4000", ""},
+		{"Default port is used when absent", "http://localhost/", ""},
+		{"Scheme must match", "https://localhost:3001", ""},
+		{"Path glob spans segments", "https://example.com/docs/a/b/edit", "/Applications/Edge.app"},
+		{"Path glob must match fully", "https://example.com/docs/a/view", ""},
+		{"Query values and presence", "https://example.com/?account=work&debug", "/Applications/Opera.app"},
+		{"Query value mismatch", "https://example.com/?account=home&debug=1", ""},
+		{"Query key missing", "https://example.com/?account=work", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := service.FindBrowserForURL(tt.url)
+			if result != tt.expected {
+				t.Errorf("FindBrowserForURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPatternService_FindBrowserForURL_DefaultPortMatcher(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Matchers:   []services.URLMatcher{{Host: "intranet", Port: "443"}},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	if result := service.FindBrowserForURL("https://intranet/home"); result != "/Applications/Chrome.app" {
+		t.Errorf("https without explicit port should match port 443, got %q", result)
+	}
+	if result := service.FindBrowserForURL("https://intranet:8443/home"); result != "" {
+		t.Errorf("explicit port 8443 should not match port 443, got %q", result)
+	}
+}
+
+func TestPatternService_FindBrowserForURL_MatchersWithPatterns(t *testing.T) {
+	testConfig := services.Config{
+		Browsers: []services.BrowserConfig{
+			{
+				Patterns:   []string{"gitlab"},
+				Matchers:   []services.URLMatcher{{Host: "github.com"}},
+				BrowserURL: "/Applications/Chrome.app",
+			},
+		},
+	}
+
+	service := services.NewPatternService(testConfig)
+
+	for _, u := range []string{"https://github.com", "https://gitlab.com"} {
+		if result := service.FindBrowserForURL(u); result != "/Applications/Chrome.app" {
+			t.Errorf("FindBrowserForURL(%q) = %q, want Chrome", u, result)
+		}
+	}
+}